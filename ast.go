@@ -1,5 +1,7 @@
 package pdf
 
+import "time"
+
 // Forward declaration for PdfLibDoc
 type PdfLibDoc struct {
 	FontSize float64
@@ -32,12 +34,89 @@ const (
 	DirectionColumn Direction = "column"
 )
 
+// Justify distributes children along the main axis of a container
+type Justify string
+
+const (
+	JustifyStart        Justify = "start"
+	JustifyCenter       Justify = "center"
+	JustifyEnd          Justify = "end"
+	JustifySpaceBetween Justify = "space-between"
+	JustifySpaceAround  Justify = "space-around"
+)
+
+// VAlign is the vertical alignment of the content of a fixed height widget
+type VAlign string
+
+const (
+	VAlignTop    VAlign = "top"
+	VAlignMiddle VAlign = "middle"
+	VAlignBottom VAlign = "bottom"
+)
+
+// Overflow defines how text that does not fit in its box is handled
+type Overflow string
+
+const (
+	OverflowClip     Overflow = "clip"
+	OverflowEllipsis Overflow = "ellipsis"
+	OverflowShrink   Overflow = "shrink"
+)
+
+// Fit defines how an image is sized to its box
+type Fit string
+
+const (
+	FitContain Fit = "contain"
+	FitCover   Fit = "cover"
+	FitFill    Fit = "fill"
+	FitNone    Fit = "none"
+)
+
+// AlignItems positions children along the cross axis of a container
+type AlignItems string
+
+const (
+	AlignItemsStart   AlignItems = "start"
+	AlignItemsCenter  AlignItems = "center"
+	AlignItemsEnd     AlignItems = "end"
+	AlignItemsStretch AlignItems = "stretch"
+)
+
+// PageVariant selects the pages of a header or footer variant
+type PageVariant string
+
+const (
+	PageFirst PageVariant = "first" // first page of a <page>
+	PageLast  PageVariant = "last"  // last page of a <page>
+	PageOdd   PageVariant = "odd"   // odd pages of the document
+	PageEven  PageVariant = "even"  // even pages of the document
+	PageRest  PageVariant = "rest"  // pages of a <page> but the first
+)
+
+// PageNumberFormat defines how the page numbers of a page are written
+type PageNumberFormat string
+
+const (
+	PageNumberDecimal    PageNumberFormat = "decimal"
+	PageNumberLowerRoman PageNumberFormat = "lower-roman"
+	PageNumberUpperRoman PageNumberFormat = "upper-roman"
+	PageNumberLowerAlpha PageNumberFormat = "lower-alpha"
+	PageNumberUpperAlpha PageNumberFormat = "upper-alpha"
+)
+
 // Document represents the root PDF document
 type Document struct {
 	Widget
 	PDF      any        `json:"pdf,omitempty"`
 	PdLibDoc *PdfLibDoc `json:"-"` // PDF library document for layout calculations
 	Pages    []*Page    `json:"pages,omitempty"`
+
+	// Date is the value of the {date} placeholders, the current time if zero
+	Date time.Time `json:"-"`
+
+	// Footnotes places the notes at the bottom of the pages by default
+	Footnotes FootnoteMode `json:"footnotes,omitempty"`
 }
 
 // DocumentJSON is used for JSON serialization
@@ -159,6 +238,63 @@ type Page struct {
 	Header           *Widget `json:"header,omitempty"`
 	Footer           *Widget `json:"footer,omitempty"`
 	ResetPageNumbers bool    `json:"resetPageNumbers,omitempty"`
+
+	// PageNumberFormat writes the {page} and {pages} placeholders and
+	// PageNumberStart restarts the numbering at the given number
+	PageNumberFormat PageNumberFormat `json:"pageNumberFormat,omitempty"`
+	PageNumberStart  int              `json:"pageNumberStart,omitempty"`
+
+	// Title is the {section} placeholder of the pages split from the page
+	Title string `json:"title,omitempty"`
+
+	// SectionPage and SectionPages number the pages split from the same <page>
+	SectionPage  int `json:"sectionPage,omitempty"`
+	SectionPages int `json:"sectionPages,omitempty"`
+
+	// Headers and Footers are the variants selected by their on attribute.
+	// Once the page is split they replace Header and Footer on each page.
+	Headers map[PageVariant]*Widget `json:"headers,omitempty"`
+	Footers map[PageVariant]*Widget `json:"footers,omitempty"`
+
+	// Notes are the footnotes placed at the bottom of the page
+	Notes []*Widget `json:"notes,omitempty"`
+
+	// HeaderSpacing and FooterSpacing separate the content from the
+	// header and the footer, which it never overlaps
+	HeaderSpacing float64 `json:"headerSpacing,omitempty"`
+	FooterSpacing float64 `json:"footerSpacing,omitempty"`
+
+	// Background is drawn beneath the content, Overlay and Watermark above
+	Background *Widget `json:"background,omitempty"`
+	Overlay    *Widget `json:"overlay,omitempty"`
+	Watermark  *Widget `json:"watermark,omitempty"`
+}
+
+// layer returns the watermark, background or overlay of the page
+func (p *Page) layer(tag string) *Widget {
+	switch tag {
+	case "watermark":
+		return p.Watermark
+	case "background":
+		return p.Background
+	case "overlay":
+		return p.Overlay
+	}
+	return nil
+}
+
+// variants returns the header and footer variants of the page
+func (p *Page) variants() []*Widget {
+	var result []*Widget
+	for _, on := range []PageVariant{PageFirst, PageLast, PageOdd, PageEven, PageRest} {
+		if w := p.Headers[on]; w != nil {
+			result = append(result, w)
+		}
+		if w := p.Footers[on]; w != nil {
+			result = append(result, w)
+		}
+	}
+	return result
 }
 
 // Div represents a container element
@@ -205,6 +341,7 @@ type Image struct {
 	Widget
 	Bytes        []byte  `json:"bytes,omitempty"`
 	Data         string  `json:"data,omitempty"`
+	Src          string  `json:"src,omitempty"`
 	ImgWidth     float64 `json:"imgWidth,omitempty"`
 	ImgHeight    float64 `json:"imgHeight,omitempty"`
 	ImgMaxWidth  float64 `json:"imgMaxWidth,omitempty"`
@@ -218,6 +355,12 @@ type QRCode struct {
 	Level   string `json:"level,omitempty"`
 	Version int    `json:"version,omitempty"`
 	Size    int    `json:"size,omitempty"`
+
+	// Border is the quiet zone in modules, Logo the source of an image
+	// drawn in the center at LogoSize of the code size
+	Border   int     `json:"border,omitempty"`
+	Logo     string  `json:"logo,omitempty"`
+	LogoSize float64 `json:"logoSize,omitempty"`
 }
 
 // Widget is the base type for all PDF elements
@@ -242,12 +385,24 @@ type Widget struct {
 	Hidden          bool            `json:"hidden,omitempty"`
 	Value           string          `json:"value,omitempty"`
 	ValueLines      []string        `json:"valueLines,omitempty"`
-	Wrap            bool            `json:"wrap,omitempty"`
+	Wrap            bool            `json:"wrap,omitempty"` // Deprecated: use MaxLines 1
+	Overflow        Overflow        `json:"overflow,omitempty"`
+	MaxLines        int             `json:"maxLines,omitempty"`
+	MinFontSize     float64         `json:"minFontSize,omitempty"`
 	Align           string          `json:"align,omitempty"`
+	VAlign          VAlign          `json:"valign,omitempty"`
 	Option          *CellOption     `json:"option,omitempty"`
 	Calculated      *CalculatedInfo `json:"calculated,omitempty"`
 	PageNumber      int             `json:"pageNumber,omitempty"`
 
+	// Flexbox-like layout of the children along the main axis (justify)
+	// and the cross axis (alignItems), and how a child grows or shrinks
+	// to take the free space of its row or column container.
+	Justify    Justify    `json:"justify,omitempty"`
+	AlignItems AlignItems `json:"alignItems,omitempty"`
+	Grow       float64    `json:"grow,omitempty"`
+	Shrink     *float64   `json:"shrink,omitempty"`
+
 	// Table-specific fields added to Widget for carry functionality
 	// This enables 1:1 translation with TypeScript without complex casting
 	Columns        []*TableColumn `json:"columns,omitempty"`
@@ -262,13 +417,81 @@ type Widget struct {
 	CellPadding    *Box           `json:"cellPadding,omitempty"`
 	IsHeader       bool           `json:"isHeader,omitempty"`
 
+	// Drawing-specific fields for when widget.Type is "line", "rect", "circle",
+	// "ellipse", "polygon" or "path". Geometry is relative to the content box.
+	Stroke     *LineStyle `json:"stroke,omitempty"`
+	StrokeDash []float64  `json:"strokeDash,omitempty"`
+	FillColor  *Color     `json:"fillColor,omitempty"`
+	Radius     float64    `json:"radius,omitempty"`
+	Line       *Line      `json:"line,omitempty"`
+	Path       *Path      `json:"path,omitempty"`
+
 	// Image-specific fields for when widget.Type == "image" or "qr"
 	Bytes        []byte  `json:"bytes,omitempty"`
 	Data         string  `json:"data,omitempty"`
+	Src          string  `json:"src,omitempty"`
 	ImgWidth     float64 `json:"imgWidth,omitempty"`
 	ImgHeight    float64 `json:"imgHeight,omitempty"`
 	ImgMaxWidth  float64 `json:"imgMaxWidth,omitempty"`
 	ImgMaxHeight float64 `json:"imgMaxHeight,omitempty"`
+
+	// Fit and ImagePosition place the image inside the box set by
+	// ImgWidth and ImgHeight, cropping it with FitCover
+	Fit           Fit    `json:"fit,omitempty"`
+	ImagePosition string `json:"imagePosition,omitempty"`
+
+	// SVG is set when the image data is an SVG document
+	SVG *SVGImage `json:"svg,omitempty"`
+
+	// Barcode is set when widget.Type == "barcode" or "qr"
+	Barcode *Barcode `json:"barcode,omitempty"`
+
+	// Opacity from 0 to 1 applies to the widget and its children
+	Opacity *float64 `json:"opacity,omitempty"`
+
+	// Angle is set when widget.Type == "watermark", clockwise like Rotate
+	Angle float64 `json:"angle,omitempty"`
+
+	// Heading is the level of the widget in the tables of contents
+	Heading int `json:"heading,omitempty"`
+
+	// TOC is set on <toc> widgets until they are replaced by their entries
+	TOC *TOC `json:"toc,omitempty"`
+
+	// List is set on <ul> and <ol> widgets, split between their items
+	List *List `json:"list,omitempty"`
+
+	// TOCTarget is the heading whose page number a TOC entry shows
+	TOCTarget *Widget `json:"-"`
+
+	// Footnotes are the notes referenced in the text, where the marker is
+	// replaced by their number
+	Footnotes []*Widget `json:"footnotes,omitempty"`
+
+	// Leader is repeated from the end of the text to the right edge
+	Leader string `json:"leader,omitempty"`
+
+	// RunningHeader marks the widgets whose text is the {runningHeader}
+	// placeholder of their page and the next ones until another is found
+	RunningHeader bool `json:"runningHeader,omitempty"`
+
+	// Rotate turns the widget and its children clockwise around its
+	// center, quarter turns also swap its width and height in the layout
+	Rotate float64 `json:"rotate,omitempty"`
+
+	// Transform is the a b c d e f matrix applied around the widget
+	// center after Rotate, without changing the layout
+	Transform []float64 `json:"transform,omitempty"`
+
+	// Field is set on form field widgets
+	Field *FormField `json:"field,omitempty"`
+
+	// Logo is the image drawn in the center of a QR code
+	Logo *Widget `json:"logo,omitempty"`
+
+	// ImageInfo is set when the image is loaded, it is shared by the
+	// widgets with the same image
+	ImageInfo *ImageInfo `json:"-"`
 }
 
 // CellOption represents PDF cell options like in TypeScript
@@ -296,6 +519,10 @@ type CalculatedInfo struct {
 	Bold        bool      `json:"bold,omitempty"`
 	Color       *Color    `json:"color,omitempty"`
 	Direction   Direction `json:"direction,omitempty"`
+
+	// Rotated is set on quarter turned widgets, the sizes are the ones of
+	// the rotated box until makeAbsolute sets back the unrotated box
+	Rotated bool `json:"rotated,omitempty"`
 }
 
 // Rect represents a rectangle with position and size
@@ -318,9 +545,22 @@ type Box struct {
 
 // Color represents an RGB color
 type Color struct {
-	R int `json:"r"`
-	G int `json:"g"`
-	B int `json:"b"`
+	R int      `json:"r"`
+	G int      `json:"g"`
+	B int      `json:"b"`
+	A *float64 `json:"a,omitempty"` // alpha from 0 to 1, opaque if nil
+
+	// CMYK is set for colors defined in CMYK, from 0 to 100, and is
+	// rendered as DeviceCMYK. R, G and B approximate it.
+	CMYK []float64 `json:"cmyk,omitempty"`
+}
+
+// Alpha returns the alpha of the color, 1 if it is opaque
+func (c *Color) Alpha() float64 {
+	if c.A == nil {
+		return 1
+	}
+	return *c.A
 }
 
 // LineStyle represents the style of a line
@@ -348,6 +588,54 @@ type Border struct {
 	Radius float64    `json:"radius,omitempty"`
 }
 
+// forEachWidget calls fn for every widget of the document, including
+// page layers, headers and footers and table carry headers and footers.
+func (d *Document) forEachWidget(fn func(w *Widget)) {
+	for _, page := range d.Pages {
+		for _, layer := range []*Widget{page.Background, page.Overlay, page.Watermark} {
+			if layer != nil {
+				layer.forEach(fn)
+			}
+		}
+		if page.Header != nil {
+			page.Header.forEach(fn)
+		}
+		for _, child := range page.Children {
+			child.forEach(fn)
+		}
+		if page.Footer != nil {
+			page.Footer.forEach(fn)
+		}
+		for _, w := range page.variants() {
+			w.forEach(fn)
+		}
+	}
+}
+
+// forEach calls fn for the widget and all its descendants
+func (w *Widget) forEach(fn func(w *Widget)) {
+	fn(w)
+
+	if w.Logo != nil {
+		w.Logo.forEach(fn)
+	}
+
+	for _, note := range w.Footnotes {
+		note.forEach(fn)
+	}
+
+	if w.CarryHeader != nil {
+		w.CarryHeader.forEach(fn)
+	}
+	if w.CarryFooter != nil {
+		w.CarryFooter.forEach(fn)
+	}
+
+	for _, child := range w.Children {
+		child.forEach(fn)
+	}
+}
+
 // Conversion functions for JSON serialization
 
 // ToJSON converts Document to DocumentJSON with TypeScript-compatible structure
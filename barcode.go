@@ -0,0 +1,236 @@
+package pdf
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/code39"
+	"github.com/boombuler/barcode/datamatrix"
+	"github.com/boombuler/barcode/ean"
+	"github.com/boombuler/barcode/pdf417"
+	"github.com/boombuler/barcode/twooffive"
+)
+
+// BarcodeType is the symbology of a barcode
+type BarcodeType string
+
+const (
+	BarcodeCode128    BarcodeType = "code128"
+	BarcodeEAN13      BarcodeType = "ean13"
+	BarcodeUPCA       BarcodeType = "upca"
+	BarcodeCode39     BarcodeType = "code39"
+	BarcodeITF        BarcodeType = "itf"
+	BarcodeDataMatrix BarcodeType = "datamatrix"
+	BarcodePDF417     BarcodeType = "pdf417"
+	BarcodeQR         BarcodeType = "qr"
+)
+
+const (
+	// pdf417SecurityLevel is the error correction level of PDF417 codes
+	pdf417SecurityLevel = 2
+
+	// pdf417RowHeight is the height of a PDF417 row in modules
+	pdf417RowHeight = 3
+
+	// pdf417EncodedRowHeight is the height of the rows of the encoded
+	// PDF417 image, which repeats each row of modules
+	pdf417EncodedRowHeight = 2
+)
+
+// Barcode is a linear or 2D barcode drawn as vector bars
+type Barcode struct {
+	Type        BarcodeType `json:"type"`
+	Value       string      `json:"value"`
+	Text        string      `json:"text,omitempty"`        // value with the check digits
+	ShowText    bool        `json:"showText,omitempty"`    // draw the text under linear codes
+	ModuleWidth float64     `json:"moduleWidth"`           // width of the narrowest bar
+	BarHeight   float64     `json:"barHeight,omitempty"`   // height of the bars of linear codes
+	QuietZone   float64     `json:"quietZone"`             // margin around the code in modules
+	Modules     [][]bool    `json:"modules"`               // rows of dark modules
+	LogoModules int         `json:"logoModules,omitempty"` // side of the QR center left for a logo
+}
+
+// Is2D returns true for matrix and stacked codes
+func (b *Barcode) Is2D() bool {
+	return b.Type == BarcodeDataMatrix || b.Type == BarcodePDF417 || b.Type == BarcodeQR
+}
+
+// ModuleHeight returns the height of a row of modules
+func (b *Barcode) ModuleHeight() float64 {
+	switch {
+	case !b.Is2D():
+		return b.BarHeight
+	case b.Type == BarcodePDF417:
+		return b.ModuleWidth * pdf417RowHeight
+	}
+	return b.ModuleWidth
+}
+
+// Size returns the size of the code with its quiet zone, without the text
+func (b *Barcode) Size() (float64, float64) {
+	columns := 0
+	if len(b.Modules) > 0 {
+		columns = len(b.Modules[0])
+	}
+
+	quiet := b.QuietZone * b.ModuleWidth
+	width := float64(columns)*b.ModuleWidth + quiet*2
+	height := float64(len(b.Modules)) * b.ModuleHeight()
+	if b.Is2D() {
+		height += quiet * 2
+	}
+
+	return width, height
+}
+
+// defaultQuietZone returns the minimum quiet zone of the symbology in modules
+func defaultQuietZone(typ BarcodeType) float64 {
+	switch typ {
+	case BarcodeEAN13:
+		return 11
+	case BarcodeUPCA:
+		return 9
+	case BarcodeDataMatrix:
+		return 1
+	case BarcodePDF417:
+		return 2
+	}
+	return 10
+}
+
+// encodeBarcode encodes the value and sets the modules and the text of
+// the barcode. Check digits are appended to EAN-13 and UPC-A values
+// without them and validated otherwise.
+func encodeBarcode(b *Barcode, checksum bool) error {
+	var code barcode.Barcode
+	var err error
+
+	value := b.Value
+	text := value
+
+	switch b.Type {
+	case BarcodeCode128:
+		code, err = code128.Encode(value)
+
+	case BarcodeEAN13:
+		if value, err = gtinValue(value, 13); err == nil {
+			text = value
+			code, err = ean.Encode(value)
+		}
+
+	case BarcodeUPCA:
+		// A UPC-A code is an EAN-13 code starting with 0
+		if value, err = gtinValue(value, 12); err == nil {
+			text = value
+			code, err = ean.Encode("0" + value)
+		}
+
+	case BarcodeCode39:
+		code, err = code39.Encode(value, checksum, false)
+
+	case BarcodeITF:
+		if !isDigits(value) {
+			return fmt.Errorf("itf: value must be numeric: %s", value)
+		}
+		if checksum {
+			value += string(gtinCheckDigit(value))
+		}
+		if len(value)%2 != 0 {
+			return fmt.Errorf("itf: value must have an even number of digits: %s", value)
+		}
+		text = value
+		code, err = twooffive.Encode(value, true)
+
+	case BarcodeDataMatrix:
+		code, err = datamatrix.Encode(value)
+
+	case BarcodePDF417:
+		code, err = pdf417.Encode(value, pdf417SecurityLevel)
+
+	default:
+		return fmt.Errorf("invalid barcode type: %s", b.Type)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", b.Type, err)
+	}
+
+	b.Modules = barcodeModules(code)
+	switch b.Type {
+	case BarcodePDF417:
+		b.Modules = stackedRows(b.Modules, pdf417EncodedRowHeight)
+
+	case BarcodeITF:
+		// the encoder draws the wide bar of the stop pattern two modules
+		// wide instead of three like the other wide bars
+		row := b.Modules[0]
+		b.Modules[0] = append(row[:len(row)-4:len(row)-4], true, true, true, false, true)
+	}
+
+	b.Text = text
+	return nil
+}
+
+// gtinValue validates the check digit of an EAN or UPC value with the
+// given length, appending it if the value doesn't have it.
+func gtinValue(value string, length int) (string, error) {
+	if !isDigits(value) {
+		return "", fmt.Errorf("value must be numeric: %s", value)
+	}
+
+	switch len(value) {
+	case length - 1:
+		return value + string(gtinCheckDigit(value)), nil
+	case length:
+		if gtinCheckDigit(value[:length-1]) != value[length-1] {
+			return "", fmt.Errorf("invalid check digit: %s", value)
+		}
+		return value, nil
+	}
+
+	return "", fmt.Errorf("value must have %d or %d digits: %s", length-1, length, value)
+}
+
+// gtinCheckDigit computes the GS1 modulo 10 check digit, used by EAN,
+// UPC and ITF: digits are weighted 3 and 1 starting from the right.
+func gtinCheckDigit(digits string) byte {
+	sum := 0
+	weight := 3
+	for i := len(digits) - 1; i >= 0; i-- {
+		sum += int(digits[i]-'0') * weight
+		weight = 4 - weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func isDigits(v string) bool {
+	return v != "" && strings.Trim(v, "0123456789") == ""
+}
+
+// barcodeModules reads the dark modules of an encoded barcode
+func barcodeModules(code barcode.Barcode) [][]bool {
+	bounds := code.Bounds()
+
+	rows := make([][]bool, bounds.Dy())
+	for y := range rows {
+		rows[y] = make([]bool, bounds.Dx())
+		for x := range rows[y] {
+			r, g, b, _ := code.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			rows[y][x] = r+g+b < 3*0x8000
+		}
+	}
+
+	return rows
+}
+
+// stackedRows returns the rows of modules of a stacked code from the rows
+// of its image, where each row is repeated height times
+func stackedRows(rows [][]bool, height int) [][]bool {
+	result := make([][]bool, 0, len(rows)/height)
+	for y := 0; y < len(rows); y += height {
+		result = append(result, rows[y])
+	}
+	return result
+}
@@ -0,0 +1,266 @@
+package pdf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// moduleString writes a row of modules as ones and zeros
+func moduleString(row []bool) string {
+	var b strings.Builder
+	for _, dark := range row {
+		if dark {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+	return b.String()
+}
+
+func TestEncodeLinearBarcode(t *testing.T) {
+	tests := []struct {
+		name     string
+		typ      BarcodeType
+		value    string
+		checksum bool
+		text     string
+		modules  string
+	}{
+		{"code128", BarcodeCode128, "A", false, "A",
+			// start B, A, check symbol 34, stop
+			"11010010000" + "10100011000" + "10001011000" + "1100011101011"},
+		{"code39", BarcodeCode39, "A", false, "A",
+			"100101101101" + "0" + "110101001011" + "0" + "100101101101"},
+		{"ean13", BarcodeEAN13, "400638133393", false, "4006381333931",
+			// first digit 4, left digits with the parities LGLLGG
+			"101" + "0001101" + "0100111" + "0101111" + "0111101" + "0001001" + "0110011" +
+				"01010" + "1000010" + "1000010" + "1000010" + "1110100" + "1000010" + "1100110" + "101"},
+		{"ean13 with check digit", BarcodeEAN13, "4006381333931", false, "4006381333931", ""},
+		{"upca", BarcodeUPCA, "03600029145", false, "036000291452",
+			"101" + "0001101" + "0111101" + "0101111" + "0001101" + "0001101" + "0001101" +
+				"01010" + "1101100" + "1110100" + "1100110" + "1011100" + "1001110" + "1101100" + "101"},
+		{"itf", BarcodeITF, "12", false, "12",
+			// start, bars of 1 interleaved with spaces of 2, stop
+			"1010" + "111010001010111000" + "11101"},
+		{"itf with check digit", BarcodeITF, "1234567", true, "12345670", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := &Barcode{Type: test.typ, Value: test.value}
+			if err := encodeBarcode(b, test.checksum); err != nil {
+				t.Fatal(err)
+			}
+			if b.Text != test.text {
+				t.Fatalf("expected text %s, got %s", test.text, b.Text)
+			}
+			if len(b.Modules) != 1 {
+				t.Fatalf("expected one row, got %d", len(b.Modules))
+			}
+			if got := moduleString(b.Modules[0]); test.modules != "" && got != test.modules {
+				t.Fatalf("expected modules\n%s, got\n%s", test.modules, got)
+			}
+		})
+	}
+}
+
+func TestEncodeBarcodeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		typ   BarcodeType
+		value string
+	}{
+		{"ean13 check digit", BarcodeEAN13, "4006381333932"},
+		{"ean13 length", BarcodeEAN13, "40063813339"},
+		{"upca check digit", BarcodeUPCA, "036000291453"},
+		{"itf odd digits", BarcodeITF, "123"},
+		{"itf letters", BarcodeITF, "12AB"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := encodeBarcode(&Barcode{Type: test.typ, Value: test.value}, false); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestCode39Checksum(t *testing.T) {
+	// C, O, D, E, 3 and 9 add up to 75, which is 32 (W) modulo 43
+	b := &Barcode{Type: BarcodeCode39, Value: "CODE39"}
+	if err := encodeBarcode(b, true); err != nil {
+		t.Fatal(err)
+	}
+	expected := &Barcode{Type: BarcodeCode39, Value: "CODE39W"}
+	if err := encodeBarcode(expected, false); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(b.Modules, expected.Modules) {
+		t.Fatal("the check character is not W")
+	}
+}
+
+func TestEncodeDataMatrix(t *testing.T) {
+	tests := []struct {
+		value     string
+		codewords []int
+	}{
+		// ASCII value plus one, then the pad 129 and a randomized pad
+		{"A", []int{66, 129, 70}},
+		// digit pairs are 130 plus their value
+		{"123456", []int{142, 164, 186}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			b := &Barcode{Type: BarcodeDataMatrix, Value: test.value}
+			if err := encodeBarcode(b, false); err != nil {
+				t.Fatal(err)
+			}
+			if len(b.Modules) != 10 || len(b.Modules[0]) != 10 {
+				t.Fatalf("expected a 10x10 symbol, got %dx%d", len(b.Modules), len(b.Modules[0]))
+			}
+
+			// the finder is solid on the left and bottom, alternating on
+			// the top and right
+			for i := 0; i < 10; i++ {
+				if !b.Modules[i][0] || !b.Modules[9][i] || b.Modules[0][i] != (i%2 == 0) || b.Modules[i][9] != (i%2 == 1) {
+					t.Fatalf("invalid finder pattern at %d", i)
+				}
+			}
+
+			region := make([][]bool, 8)
+			for i := range region {
+				region[i] = b.Modules[i+1][1:9]
+			}
+			codewords := dataMatrixCodewords(region, 8)
+			if !reflect.DeepEqual(codewords[:len(test.codewords)], test.codewords) {
+				t.Fatalf("expected data codewords %v, got %v", test.codewords, codewords[:len(test.codewords)])
+			}
+		})
+	}
+}
+
+// dataMatrixCodewords reads the codewords of a square data region with
+// the placement of ECC 200 symbols
+func dataMatrixCodewords(region [][]bool, size int) []int {
+	var codewords []int
+	placed := make([][]bool, size)
+	for i := range placed {
+		placed[i] = make([]bool, size)
+	}
+
+	var current, bit int
+	module := func(row, col int) {
+		if row < 0 {
+			row += size
+			col += 4 - (size+4)%8
+		}
+		if col < 0 {
+			col += size
+			row += 4 - (size+4)%8
+		}
+		placed[row][col] = true
+		if region[row][col] {
+			current |= 1 << (7 - bit)
+		}
+		bit++
+		if bit == 8 {
+			codewords = append(codewords, current)
+			current, bit = 0, 0
+		}
+	}
+	utah := func(row, col int) {
+		module(row-2, col-2)
+		module(row-2, col-1)
+		module(row-1, col-2)
+		module(row-1, col-1)
+		module(row-1, col)
+		module(row, col-2)
+		module(row, col-1)
+		module(row, col)
+	}
+	corner := func(positions [8][2]int) {
+		for _, p := range positions {
+			module(p[0], p[1])
+		}
+	}
+
+	n := size
+	row, col := 4, 0
+	for row < n || col < n {
+		if row == n && col == 0 {
+			corner([8][2]int{{n - 1, 0}, {n - 1, 1}, {n - 1, 2}, {0, n - 2}, {0, n - 1}, {1, n - 1}, {2, n - 1}, {3, n - 1}})
+		}
+		if row == n-2 && col == 0 && n%4 != 0 {
+			corner([8][2]int{{n - 3, 0}, {n - 2, 0}, {n - 1, 0}, {0, n - 4}, {0, n - 3}, {0, n - 2}, {0, n - 1}, {1, n - 1}})
+		}
+		if row == n-2 && col == 0 && n%8 == 4 {
+			corner([8][2]int{{n - 3, 0}, {n - 2, 0}, {n - 1, 0}, {0, n - 2}, {0, n - 1}, {1, n - 1}, {2, n - 1}, {3, n - 1}})
+		}
+		if row == n+4 && col == 2 && n%8 == 0 {
+			corner([8][2]int{{n - 1, 0}, {n - 1, n - 1}, {0, n - 3}, {0, n - 2}, {0, n - 1}, {1, n - 3}, {1, n - 2}, {1, n - 1}})
+		}
+
+		for {
+			if row < n && col >= 0 && !placed[row][col] {
+				utah(row, col)
+			}
+			row, col = row-2, col+2
+			if row < 0 || col >= n {
+				break
+			}
+		}
+		row, col = row+1, col+3
+
+		for {
+			if row >= 0 && col < n && !placed[row][col] {
+				utah(row, col)
+			}
+			row, col = row+2, col-2
+			if row >= n || col < 0 {
+				break
+			}
+		}
+		row, col = row+3, col+1
+	}
+
+	return codewords
+}
+
+func TestEncodePDF417(t *testing.T) {
+	b := &Barcode{Type: BarcodePDF417, Value: "PDF417 stacked rows"}
+	if err := encodeBarcode(b, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b.Modules) < 3 {
+		t.Fatalf("expected at least 3 rows, got %d", len(b.Modules))
+	}
+
+	for i, row := range b.Modules {
+		s := moduleString(row)
+		if !strings.HasPrefix(s, "11111111010101000") || !strings.HasSuffix(s, "111111101000101001") {
+			t.Fatalf("row %d has no start and stop patterns: %s", i, s)
+		}
+		// each row is in the cluster of its number modulo 3, so it
+		// never equals the previous one
+		if i > 0 && s == moduleString(b.Modules[i-1]) {
+			t.Fatalf("row %d repeats the previous row", i)
+		}
+	}
+}
+
+func TestStackedRows(t *testing.T) {
+	a := []bool{true, false}
+	b := []bool{false, true}
+
+	// identical rows of modules are kept, each image row is read once
+	rows := stackedRows([][]bool{a, a, a, a, b, b}, 2)
+	if !reflect.DeepEqual(rows, [][]bool{a, a, b}) {
+		t.Fatalf("unexpected rows: %v", rows)
+	}
+}
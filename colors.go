@@ -0,0 +1,388 @@
+package pdf
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// parseColor parses a CSS-like color: "#rgb", "#rgba", "#rrggbb",
+// "#rrggbbaa", rgb(), rgba(), hsl(), hsla(), cmyk(), the comma form
+// "255,0,0" or "255,0,0,0.5" and the CSS named colors.
+func parseColor(v string) (*Color, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+
+	var color *Color
+	var ok bool
+
+	switch {
+	case strings.HasPrefix(v, "#"):
+		color, ok = parseHexColor(v[1:])
+	case strings.HasPrefix(v, "rgb(") || strings.HasPrefix(v, "rgba("):
+		color, ok = parseRGBColor(colorArgs(v))
+	case strings.HasPrefix(v, "hsl(") || strings.HasPrefix(v, "hsla("):
+		color, ok = parseHSLColor(colorArgs(v))
+	case strings.HasPrefix(v, "cmyk("):
+		color, ok = parseCMYKColor(colorArgs(v))
+	case strings.Contains(v, ","):
+		color, ok = parseRGBColor(strings.Split(v, ","))
+	case v == "transparent":
+		alpha := 0.0
+		color, ok = &Color{A: &alpha}, true
+	default:
+		var rgb int
+		if rgb, ok = namedColors[v]; ok {
+			color = &Color{R: rgb >> 16, G: rgb >> 8 & 0xFF, B: rgb & 0xFF}
+		}
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("invalid color: %s", v)
+	}
+	return color, nil
+}
+
+// cmyk returns the CMYK components of the color as PDF library values
+func (c *Color) cmyk() ([4]uint8, bool) {
+	var cmyk [4]uint8
+	if c == nil || len(c.CMYK) != 4 {
+		return cmyk, false
+	}
+	for i, v := range c.CMYK {
+		cmyk[i] = uint8(math.Round(v))
+	}
+	return cmyk, true
+}
+
+func parseHexColor(v string) (*Color, bool) {
+	n, err := strconv.ParseUint(v, 16, 32)
+	if err != nil {
+		return nil, false
+	}
+
+	var color Color
+	var alpha uint64
+
+	switch len(v) {
+	case 3, 4:
+		if len(v) == 4 {
+			alpha = (n & 0xF) * 0x11
+			n >>= 4
+		}
+		color = Color{R: int(n>>8&0xF) * 0x11, G: int(n>>4&0xF) * 0x11, B: int(n&0xF) * 0x11}
+	case 6, 8:
+		if len(v) == 8 {
+			alpha = n & 0xFF
+			n >>= 8
+		}
+		color = Color{R: int(n >> 16 & 0xFF), G: int(n >> 8 & 0xFF), B: int(n & 0xFF)}
+	default:
+		return nil, false
+	}
+
+	if len(v) == 4 || len(v) == 8 {
+		a := float64(alpha) / 255
+		color.A = &a
+	}
+
+	return &color, true
+}
+
+// colorArgs returns the arguments of a color function, separated by
+// commas or by spaces with an optional "/ alpha".
+func colorArgs(v string) []string {
+	start := strings.Index(v, "(")
+	if !strings.HasSuffix(v, ")") {
+		return nil
+	}
+
+	args := v[start+1 : len(v)-1]
+	if strings.Contains(args, ",") {
+		return strings.Split(args, ",")
+	}
+	return strings.Fields(strings.Replace(args, "/", " ", 1))
+}
+
+func parseRGBColor(args []string) (*Color, bool) {
+	if len(args) != 3 && len(args) != 4 {
+		return nil, false
+	}
+
+	var rgb [3]int
+	for i := range rgb {
+		f, ok := parseColorNumber(args[i], 255)
+		if !ok {
+			return nil, false
+		}
+		rgb[i] = int(math.Round(clampColor(f, 255)))
+	}
+
+	color := &Color{R: rgb[0], G: rgb[1], B: rgb[2]}
+	return color, parseAlpha(color, args[3:])
+}
+
+func parseHSLColor(args []string) (*Color, bool) {
+	if len(args) != 3 && len(args) != 4 {
+		return nil, false
+	}
+
+	h, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(args[0]), "deg"), 64)
+	if err != nil {
+		return nil, false
+	}
+
+	s, ok1 := parseColorNumber(args[1], 1)
+	l, ok2 := parseColorNumber(args[2], 1)
+	if !ok1 || !ok2 || !strings.HasSuffix(strings.TrimSpace(args[1]), "%") || !strings.HasSuffix(strings.TrimSpace(args[2]), "%") {
+		return nil, false
+	}
+
+	r, g, b := hslToRGB(math.Mod(math.Mod(h, 360)+360, 360)/360, clampColor(s, 1), clampColor(l, 1))
+	color := &Color{R: int(math.Round(r * 255)), G: int(math.Round(g * 255)), B: int(math.Round(b * 255))}
+	return color, parseAlpha(color, args[3:])
+}
+
+// parseCMYKColor parses cmyk(c, m, y, k) with components from 0 to 100.
+// The RGB values approximate the color for transparency and comparisons.
+func parseCMYKColor(args []string) (*Color, bool) {
+	if len(args) != 4 {
+		return nil, false
+	}
+
+	var cmyk [4]float64
+	for i := range cmyk {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(args[i]), "%"), 64)
+		if err != nil {
+			return nil, false
+		}
+		cmyk[i] = clampColor(f, 100)
+	}
+
+	c, m, y, k := cmyk[0]/100, cmyk[1]/100, cmyk[2]/100, cmyk[3]/100
+	return &Color{
+		R:    int(math.Round(255 * (1 - c) * (1 - k))),
+		G:    int(math.Round(255 * (1 - m) * (1 - k))),
+		B:    int(math.Round(255 * (1 - y) * (1 - k))),
+		CMYK: cmyk[:],
+	}, true
+}
+
+// parseColorNumber parses a color component, percentages are relative to scale
+func parseColorNumber(v string, scale float64) (float64, bool) {
+	v = strings.TrimSpace(v)
+
+	if strings.HasSuffix(v, "%") {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		return f / 100 * scale, err == nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	return f, err == nil
+}
+
+// parseAlpha sets the alpha of the color from the optional last argument
+func parseAlpha(color *Color, args []string) bool {
+	if len(args) == 0 {
+		return true
+	}
+
+	a, ok := parseColorNumber(args[0], 1)
+	if !ok {
+		return false
+	}
+
+	a = clampColor(a, 1)
+	color.A = &a
+	return true
+}
+
+func clampColor(f, limit float64) float64 {
+	return math.Max(0, math.Min(f, limit))
+}
+
+func hslToRGB(h, s, l float64) (float64, float64, float64) {
+	if s == 0 {
+		return l, l, l
+	}
+
+	var q float64
+	if l < 0.5 {
+		q = l * (1 + s)
+	} else {
+		q = l + s - l*s
+	}
+	p := 2*l - q
+
+	hue := func(t float64) float64 {
+		switch {
+		case t < 0:
+			t++
+		case t > 1:
+			t--
+		}
+		switch {
+		case t < 1.0/6:
+			return p + (q-p)*6*t
+		case t < 1.0/2:
+			return q
+		case t < 2.0/3:
+			return p + (q-p)*(2.0/3-t)*6
+		}
+		return p
+	}
+
+	return hue(h + 1.0/3), hue(h), hue(h - 1.0/3)
+}
+
+// namedColors are the CSS named colors
+var namedColors = map[string]int{
+	"aliceblue":            0xf0f8ff,
+	"antiquewhite":         0xfaebd7,
+	"aqua":                 0x00ffff,
+	"aquamarine":           0x7fffd4,
+	"azure":                0xf0ffff,
+	"beige":                0xf5f5dc,
+	"bisque":               0xffe4c4,
+	"black":                0x000000,
+	"blanchedalmond":       0xffebcd,
+	"blue":                 0x0000ff,
+	"blueviolet":           0x8a2be2,
+	"brown":                0xa52a2a,
+	"burlywood":            0xdeb887,
+	"cadetblue":            0x5f9ea0,
+	"chartreuse":           0x7fff00,
+	"chocolate":            0xd2691e,
+	"coral":                0xff7f50,
+	"cornflowerblue":       0x6495ed,
+	"cornsilk":             0xfff8dc,
+	"crimson":              0xdc143c,
+	"cyan":                 0x00ffff,
+	"darkblue":             0x00008b,
+	"darkcyan":             0x008b8b,
+	"darkgoldenrod":        0xb8860b,
+	"darkgray":             0xa9a9a9,
+	"darkgreen":            0x006400,
+	"darkgrey":             0xa9a9a9,
+	"darkkhaki":            0xbdb76b,
+	"darkmagenta":          0x8b008b,
+	"darkolivegreen":       0x556b2f,
+	"darkorange":           0xff8c00,
+	"darkorchid":           0x9932cc,
+	"darkred":              0x8b0000,
+	"darksalmon":           0xe9967a,
+	"darkseagreen":         0x8fbc8f,
+	"darkslateblue":        0x483d8b,
+	"darkslategray":        0x2f4f4f,
+	"darkslategrey":        0x2f4f4f,
+	"darkturquoise":        0x00ced1,
+	"darkviolet":           0x9400d3,
+	"deeppink":             0xff1493,
+	"deepskyblue":          0x00bfff,
+	"dimgray":              0x696969,
+	"dimgrey":              0x696969,
+	"dodgerblue":           0x1e90ff,
+	"firebrick":            0xb22222,
+	"floralwhite":          0xfffaf0,
+	"forestgreen":          0x228b22,
+	"fuchsia":              0xff00ff,
+	"gainsboro":            0xdcdcdc,
+	"ghostwhite":           0xf8f8ff,
+	"gold":                 0xffd700,
+	"goldenrod":            0xdaa520,
+	"gray":                 0x808080,
+	"green":                0x008000,
+	"greenyellow":          0xadff2f,
+	"grey":                 0x808080,
+	"honeydew":             0xf0fff0,
+	"hotpink":              0xff69b4,
+	"indianred":            0xcd5c5c,
+	"indigo":               0x4b0082,
+	"ivory":                0xfffff0,
+	"khaki":                0xf0e68c,
+	"lavender":             0xe6e6fa,
+	"lavenderblush":        0xfff0f5,
+	"lawngreen":            0x7cfc00,
+	"lemonchiffon":         0xfffacd,
+	"lightblue":            0xadd8e6,
+	"lightcoral":           0xf08080,
+	"lightcyan":            0xe0ffff,
+	"lightgoldenrodyellow": 0xfafad2,
+	"lightgray":            0xd3d3d3,
+	"lightgreen":           0x90ee90,
+	"lightgrey":            0xd3d3d3,
+	"lightpink":            0xffb6c1,
+	"lightsalmon":          0xffa07a,
+	"lightseagreen":        0x20b2aa,
+	"lightskyblue":         0x87cefa,
+	"lightslategray":       0x778899,
+	"lightslategrey":       0x778899,
+	"lightsteelblue":       0xb0c4de,
+	"lightyellow":          0xffffe0,
+	"lime":                 0x00ff00,
+	"limegreen":            0x32cd32,
+	"linen":                0xfaf0e6,
+	"magenta":              0xff00ff,
+	"maroon":               0x800000,
+	"mediumaquamarine":     0x66cdaa,
+	"mediumblue":           0x0000cd,
+	"mediumorchid":         0xba55d3,
+	"mediumpurple":         0x9370db,
+	"mediumseagreen":       0x3cb371,
+	"mediumslateblue":      0x7b68ee,
+	"mediumspringgreen":    0x00fa9a,
+	"mediumturquoise":      0x48d1cc,
+	"mediumvioletred":      0xc71585,
+	"midnightblue":         0x191970,
+	"mintcream":            0xf5fffa,
+	"mistyrose":            0xffe4e1,
+	"moccasin":             0xffe4b5,
+	"navajowhite":          0xffdead,
+	"navy":                 0x000080,
+	"oldlace":              0xfdf5e6,
+	"olive":                0x808000,
+	"olivedrab":            0x6b8e23,
+	"orange":               0xffa500,
+	"orangered":            0xff4500,
+	"orchid":               0xda70d6,
+	"palegoldenrod":        0xeee8aa,
+	"palegreen":            0x98fb98,
+	"paleturquoise":        0xafeeee,
+	"palevioletred":        0xdb7093,
+	"papayawhip":           0xffefd5,
+	"peachpuff":            0xffdab9,
+	"peru":                 0xcd853f,
+	"pink":                 0xffc0cb,
+	"plum":                 0xdda0dd,
+	"powderblue":           0xb0e0e6,
+	"purple":               0x800080,
+	"rebeccapurple":        0x663399,
+	"red":                  0xff0000,
+	"rosybrown":            0xbc8f8f,
+	"royalblue":            0x4169e1,
+	"saddlebrown":          0x8b4513,
+	"salmon":               0xfa8072,
+	"sandybrown":           0xf4a460,
+	"seagreen":             0x2e8b57,
+	"seashell":             0xfff5ee,
+	"sienna":               0xa0522d,
+	"silver":               0xc0c0c0,
+	"skyblue":              0x87ceeb,
+	"slateblue":            0x6a5acd,
+	"slategray":            0x708090,
+	"slategrey":            0x708090,
+	"snow":                 0xfffafa,
+	"springgreen":          0x00ff7f,
+	"steelblue":            0x4682b4,
+	"tan":                  0xd2b48c,
+	"teal":                 0x008080,
+	"thistle":              0xd8bfd8,
+	"tomato":               0xff6347,
+	"turquoise":            0x40e0d0,
+	"violet":               0xee82ee,
+	"wheat":                0xf5deb3,
+	"white":                0xffffff,
+	"whitesmoke":           0xf5f5f5,
+	"yellow":               0xffff00,
+	"yellowgreen":          0x9acd32,
+}
@@ -0,0 +1,303 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// maxComponentDepth limits nested includes and uses, catching recursion
+const maxComponentDepth = 32
+
+// ErrTemplateNotFound is returned by loaders that don't know an include source
+var ErrTemplateNotFound = errors.New("template not found")
+
+// TemplateLoader loads the XML referenced by <include src="...">
+type TemplateLoader interface {
+	LoadTemplate(src string) (string, error)
+}
+
+// TemplateAssets loads templates from memory by name, like "header.xml"
+type TemplateAssets map[string]string
+
+func (t TemplateAssets) LoadTemplate(src string) (string, error) {
+	v, ok := t[src]
+	if !ok {
+		return "", ErrTemplateNotFound
+	}
+	return v, nil
+}
+
+// TemplateLoaderFunc adapts a function to the TemplateLoader interface
+type TemplateLoaderFunc func(src string) (string, error)
+
+func (f TemplateLoaderFunc) LoadTemplate(src string) (string, error) {
+	return f(src)
+}
+
+// component is a <define> element, its children are copied by <use>
+type component struct {
+	el       *etree.Element
+	defaults map[string]string
+}
+
+// ExpandComponents replaces the <include> elements with the loaded XML and
+// the <use> elements with the children of the <define> element of the same
+// name, replacing the {param} placeholders with the attributes of the use.
+// Includes fail with a nil loader.
+func ExpandComponents(doc *etree.Document, loader TemplateLoader) error {
+	root := doc.Root()
+	if root == nil {
+		return nil
+	}
+
+	if err := expandIncludes(root, loader, nil); err != nil {
+		return err
+	}
+
+	components := map[string]*component{}
+	if err := collectComponents(root, components); err != nil {
+		return err
+	}
+
+	return expandUses(root, components, 0)
+}
+
+// expandIncludes replaces the includes of the children of el. The root
+// element of the loaded XML replaces the include, a <fragment> root is
+// replaced by its children to include several elements.
+func expandIncludes(el *etree.Element, loader TemplateLoader, stack []string) error {
+	for _, child := range el.ChildElements() {
+		if child.Tag != "include" {
+			if err := expandIncludes(child, loader, stack); err != nil {
+				return err
+			}
+			continue
+		}
+
+		src := child.SelectAttrValue("src", "")
+		if src == "" {
+			return fmt.Errorf("include: missing src attribute")
+		}
+
+		for _, v := range stack {
+			if v == src {
+				return fmt.Errorf("include: %s includes itself", src)
+			}
+		}
+		if len(stack) >= maxComponentDepth {
+			return fmt.Errorf("include: %s: too many nested includes", src)
+		}
+
+		if loader == nil {
+			return fmt.Errorf("include: %s: no template loader", src)
+		}
+
+		str, err := loader.LoadTemplate(src)
+		if err != nil {
+			return fmt.Errorf("include: %s: %w", src, err)
+		}
+
+		doc := etree.NewDocument()
+		if err := doc.ReadFromString(str); err != nil {
+			return fmt.Errorf("include: %s: %w", src, err)
+		}
+
+		included := doc.Root()
+		if included == nil {
+			return fmt.Errorf("include: %s: no root element", src)
+		}
+
+		// expanded in a wrapper so that the root can be an include too
+		wrapper := etree.NewElement("fragment")
+		wrapper.AddChild(included)
+		if err := expandIncludes(wrapper, loader, append(stack, src)); err != nil {
+			return err
+		}
+
+		var tokens []etree.Token
+		for _, e := range wrapper.ChildElements() {
+			if e.Tag == "fragment" {
+				tokens = append(tokens, contentTokens(e, false)...)
+			} else {
+				tokens = append(tokens, e)
+			}
+		}
+
+		replaceElement(child, tokens)
+	}
+
+	return nil
+}
+
+// collectComponents removes the <define> elements and adds them by name
+func collectComponents(el *etree.Element, components map[string]*component) error {
+	for _, child := range el.ChildElements() {
+		if child.Tag != "define" {
+			if err := collectComponents(child, components); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := child.SelectAttrValue("name", "")
+		if name == "" {
+			return fmt.Errorf("define: missing name attribute")
+		}
+		if _, ok := components[name]; ok {
+			return fmt.Errorf("define: duplicated component: %s", name)
+		}
+
+		c := &component{el: child, defaults: map[string]string{}}
+		for _, param := range child.SelectElements("param") {
+			paramName := param.SelectAttrValue("name", "")
+			if paramName == "" {
+				return fmt.Errorf("define: %s: param without name", name)
+			}
+			c.defaults[paramName] = param.SelectAttrValue("default", "")
+			child.RemoveChild(param)
+		}
+
+		// defines inside a define are global too
+		if err := collectComponents(child, components); err != nil {
+			return err
+		}
+
+		components[name] = c
+		el.RemoveChild(child)
+	}
+
+	return nil
+}
+
+// expandUses replaces the uses of the children of el with a copy of the
+// children of their component. The children of the use replace the
+// <slot/> elements of the copy.
+func expandUses(el *etree.Element, components map[string]*component, depth int) error {
+	for _, child := range el.ChildElements() {
+		if child.Tag != "use" {
+			if err := expandUses(child, components, depth); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := child.SelectAttrValue("component", "")
+		if name == "" {
+			return fmt.Errorf("use: missing component attribute")
+		}
+
+		c, ok := components[name]
+		if !ok {
+			return fmt.Errorf("use: unknown component: %s", name)
+		}
+
+		if depth >= maxComponentDepth {
+			return fmt.Errorf("use: %s: too many nested components", name)
+		}
+
+		params := map[string]string{}
+		for k, v := range c.defaults {
+			params[k] = v
+		}
+		for _, attr := range child.Attr {
+			if attr.Key != "component" {
+				params[attr.Key] = attr.Value
+			}
+		}
+
+		// the copy is expanded in a wrapper so that its root can be a use too
+		wrapper := c.el.Copy()
+		replaceParams(wrapper, params)
+		fillSlots(wrapper, child)
+
+		if err := expandUses(wrapper, components, depth+1); err != nil {
+			return err
+		}
+
+		replaceElement(child, contentTokens(wrapper, false))
+	}
+
+	return nil
+}
+
+// replaceParams replaces the {param} placeholders of the attributes and
+// texts. Other placeholders, like {page}, are kept.
+func replaceParams(el *etree.Element, params map[string]string) {
+	if len(params) == 0 {
+		return
+	}
+
+	pairs := make([]string, 0, len(params)*2)
+	for k, v := range params {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	var replace func(el *etree.Element)
+	replace = func(el *etree.Element) {
+		for i := range el.Attr {
+			el.Attr[i].Value = replacer.Replace(el.Attr[i].Value)
+		}
+
+		for _, token := range el.Child {
+			switch t := token.(type) {
+			case *etree.CharData:
+				t.Data = replacer.Replace(t.Data)
+			case *etree.Element:
+				replace(t)
+			}
+		}
+	}
+
+	replace(el)
+}
+
+// fillSlots replaces the <slot/> elements with copies of the children of the use
+func fillSlots(el *etree.Element, use *etree.Element) {
+	for _, child := range el.ChildElements() {
+		if child.Tag != "slot" {
+			fillSlots(child, use)
+			continue
+		}
+
+		replaceElement(child, contentTokens(use, true))
+	}
+}
+
+// contentTokens returns the child elements and texts of el, skipping
+// the whitespace between elements
+func contentTokens(el *etree.Element, clone bool) []etree.Token {
+	var tokens []etree.Token
+	for _, token := range el.Child {
+		switch t := token.(type) {
+		case *etree.Element:
+			if clone {
+				t = t.Copy()
+			}
+			tokens = append(tokens, t)
+		case *etree.CharData:
+			if strings.TrimSpace(t.Data) == "" {
+				continue
+			}
+			if clone {
+				t = etree.NewCharData(t.Data)
+			}
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+// replaceElement replaces el with the tokens in its parent
+func replaceElement(el *etree.Element, tokens []etree.Token) {
+	parent := el.Parent()
+	index := el.Index()
+
+	parent.RemoveChild(el)
+	for i, t := range tokens {
+		parent.InsertChildAt(index+i, t)
+	}
+}
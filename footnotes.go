@@ -0,0 +1,155 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// FootnoteMode defines where the notes of <footnote> elements are placed
+type FootnoteMode string
+
+const (
+	FootnotesPage FootnoteMode = "page" // bottom of the page of the reference
+	FootnotesEnd  FootnoteMode = "end"  // end of the document, as endnotes
+)
+
+const (
+	// footnoteMarker is replaced by the number of the note in the text
+	footnoteMarker = "{footnote}"
+
+	// footnoteSpacing separates the notes from the content, the
+	// separator line is drawn in the middle
+	footnoteSpacing = 10
+)
+
+// parseFootnote parses the note of a <footnote> element. Its reference is
+// added to the text of the parent widget.
+func parseFootnote(el *etree.Element) (*Widget, error) {
+	div, err := parseDiv(el)
+	if err != nil {
+		return nil, err
+	}
+	div.Type = "div"
+	return &div.Widget, nil
+}
+
+// numberFootnotes numbers the footnotes in document order, replacing the
+// markers in the text of the references. Endnotes are moved to the end of
+// the last page.
+func numberFootnotes(doc *Document) {
+	var notes []*Widget
+
+	for _, page := range doc.Pages {
+		for _, w := range page.Children {
+			w.forEach(func(w *Widget) {
+				for _, note := range w.Footnotes {
+					notes = append(notes, note)
+					number := superscript(len(notes))
+
+					w.Value = strings.Replace(w.Value, footnoteMarker, number, 1)
+					for i, line := range w.ValueLines {
+						if strings.Contains(line, footnoteMarker) {
+							w.ValueLines[i] = strings.Replace(line, footnoteMarker, number, 1)
+							break
+						}
+					}
+
+					note.Value = number + " " + note.Value
+					if len(note.ValueLines) > 0 {
+						note.ValueLines[0] = number + " " + note.ValueLines[0]
+					} else {
+						note.ValueLines = []string{note.Value}
+					}
+				}
+
+				if doc.Footnotes == FootnotesEnd {
+					w.Footnotes = nil
+				}
+			})
+		}
+	}
+
+	if doc.Footnotes == FootnotesEnd && len(notes) > 0 && len(doc.Pages) > 0 {
+		first := notes[0]
+		if first.Margin == nil {
+			first.Margin = &Box{}
+		}
+		first.Margin.Top += footnoteSpacing * 2
+
+		page := doc.Pages[len(doc.Pages)-1]
+		page.Children = append(page.Children, notes...)
+	}
+}
+
+// superscript writes a number with superscript digits
+func superscript(n int) string {
+	digits := []rune("⁰¹²³⁴⁵⁶⁷⁸⁹")
+	var sb strings.Builder
+	for _, c := range strconv.Itoa(n) {
+		sb.WriteRune(digits[c-'0'])
+	}
+	return sb.String()
+}
+
+// widgetFootnotes returns the notes referenced by a widget and its children
+func widgetFootnotes(w *Widget) []*Widget {
+	var notes []*Widget
+	w.forEach(func(w *Widget) {
+		notes = append(notes, w.Footnotes...)
+	})
+	return notes
+}
+
+// footnotesHeight returns the height the notes take on a page, with the
+// spacing above the first notes of the page
+func footnotesHeight(page *Page, notes []*Widget) float64 {
+	if len(notes) == 0 {
+		return 0
+	}
+
+	height := float64(0)
+	if len(page.Notes) == 0 {
+		height += footnoteSpacing
+	}
+	for _, note := range notes {
+		height += note.Calculated.OuterHeight
+	}
+	return height
+}
+
+// reserveFootnotes adds notes to a page, shrinking its content area
+func (l *Layouter) reserveFootnotes(page *Page, notes []*Widget) {
+	height := footnotesHeight(page, notes)
+	page.Calculated.InnerHeight -= height
+	page.Notes = append(page.Notes, notes...)
+}
+
+// makeFootnotesAbsolute places the notes of a page below its content area
+func (l *Layouter) makeFootnotesAbsolute(page *Page) {
+	y := page.Calculated.Y + page.Calculated.InnerHeight + footnoteSpacing
+	for _, note := range page.Notes {
+		l.makeWidgetAbsolute(note, page.Calculated.X, y)
+		y += note.Calculated.OuterHeight
+	}
+}
+
+// renderFootnotes draws the notes of a page below a short separator line
+func (r *Renderer) renderFootnotes(page *Page) error {
+	if len(page.Notes) == 0 {
+		return nil
+	}
+
+	y := page.Notes[0].Calculated.OuterY - footnoteSpacing/2
+	x := page.Calculated.X
+	r.drawLine(x, y, x+page.Calculated.InnerWidth/3, y, &LineStyle{Width: 0.5, Color: page.Calculated.Color})
+
+	for _, note := range page.Notes {
+		if err := r.renderWidget(note); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,511 @@
+package pdf
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Field flags of the AcroForm field dictionaries
+const (
+	fieldReadOnly    = 1 << 0
+	fieldRequired    = 1 << 1
+	fieldMultiline   = 1 << 12
+	fieldNoToggleOff = 1 << 14
+	fieldRadio       = 1 << 15
+	fieldCombo       = 1 << 17
+)
+
+// FormField is set on <textfield>, <checkbox>, <radio>, <select> and
+// <signatureField> widgets. They are laid out and drawn like other widgets
+// and emitted as AcroForm fields on top. Widgets with the same name are
+// the same field, like the radios of a group.
+type FormField struct {
+	Name      string        `json:"name"`
+	Value     string        `json:"value,omitempty"` // text, selected option or export value of a radio
+	Checked   bool          `json:"checked,omitempty"`
+	Options   []FieldOption `json:"options,omitempty"`
+	Required  bool          `json:"required,omitempty"`
+	ReadOnly  bool          `json:"readOnly,omitempty"`
+	Multiline bool          `json:"multiline,omitempty"`
+	MaxLength int           `json:"maxLength,omitempty"`
+}
+
+// FieldOption is an <option> of a select
+type FieldOption struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+// renderedField is a field widget and the index of the page it is drawn on
+type renderedField struct {
+	widget *Widget
+	page   int
+}
+
+func parseFormField(el *etree.Element) (*Widget, error) {
+	w, err := parseWidget(el)
+	if err != nil {
+		return nil, err
+	}
+
+	field := &FormField{
+		Name:     getAttrValue(el, "name", ""),
+		Value:    getAttrValue(el, "value", ""),
+		Checked:  parseBoolAttr(el, "checked", false),
+		Required: parseBoolAttr(el, "required", false),
+		ReadOnly: parseBoolAttr(el, "readOnly", false),
+	}
+
+	if field.Name == "" {
+		return nil, fmt.Errorf("%s: missing name attribute", el.Tag)
+	}
+
+	// the appearances are written with the standard fonts of the viewers
+	if v := getAttrValue(el, "fontFamily", ""); v != "" {
+		return nil, fmt.Errorf("%s: %s: fontFamily is not supported, fields use Helvetica: %s", el.Tag, field.Name, v)
+	}
+
+	switch el.Tag {
+	case "textfield":
+		if field.Value == "" {
+			field.Value = strings.TrimSpace(el.Text())
+		}
+		field.Multiline = parseBoolAttr(el, "multiline", false)
+
+		v := getAttrValue(el, "maxLength", "0")
+		maxLength, err := strconv.Atoi(v)
+		if err != nil || maxLength < 0 {
+			return nil, fmt.Errorf("textfield: invalid maxLength value: %s", v)
+		}
+		field.MaxLength = maxLength
+
+	case "radio":
+		if field.Value == "" {
+			return nil, fmt.Errorf("radio: %s: missing value attribute", field.Name)
+		}
+
+	case "select":
+		found := field.Value == ""
+		for _, child := range el.ChildElements() {
+			if child.Tag != "option" {
+				return nil, fmt.Errorf("select: invalid child: %s", child.Tag)
+			}
+			label := strings.TrimSpace(child.Text())
+			option := FieldOption{Value: getAttrValue(child, "value", label), Label: label}
+			field.Options = append(field.Options, option)
+			found = found || option.Value == field.Value
+		}
+		if !found {
+			return nil, fmt.Errorf("select: %s: invalid value: %s", field.Name, field.Value)
+		}
+	}
+
+	w.Field = field
+	return w, nil
+}
+
+// initFieldSize sets the default size of form fields from their font
+func (l *Layouter) initFieldSize(w *Widget) {
+	switch w.Type {
+	case "checkbox", "radio":
+		if w.Width == 0 {
+			w.Width = w.Calculated.FontSize
+		}
+		if w.Height == 0 {
+			w.Height = w.Width
+		}
+
+	case "signatureField":
+		if w.Height == 0 {
+			w.Height = w.Calculated.LineHeight * 3
+		}
+
+	default:
+		if w.Height == 0 {
+			lines := 1
+			if w.Field.Multiline {
+				lines = 3
+			}
+			w.Height = w.Calculated.LineHeight*float64(lines) + 4
+		}
+	}
+
+	l.addjustCalculatedSize(w)
+}
+
+// renderField draws the background and border of a field, the field
+// itself is added to the page when the document is written
+func (r *Renderer) renderField(w *Widget) error {
+	r.renderColors(w)
+	r.renderBorder(w)
+
+	r.fields = append(r.fields, &renderedField{widget: w, page: r.pdf.GetNumberOfPages() - 1})
+	return nil
+}
+
+// fieldFonts are the objects of the fonts of the field appearances
+type fieldFonts struct {
+	helv, hebo, zadb int
+}
+
+// addFormFields adds the AcroForm of the rendered fields to the PDF, as
+// an incremental update. Every widget has its own appearance, the text of
+// text and choice fields in Helvetica and the checks in ZapfDingbats.
+func (r *Renderer) addFormFields(data []byte) ([]byte, error) {
+	file, err := readPDFFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := file.pages()
+	if err != nil {
+		return nil, err
+	}
+
+	u := newPDFUpdate(file)
+	fonts := fieldFonts{
+		helv: u.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>"),
+		hebo: u.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>"),
+		zadb: u.add("<< /Type /Font /Subtype /Type1 /BaseFont /ZapfDingbats >>"),
+	}
+
+	// the widgets of each field in document order
+	var names []string
+	groups := map[string][]*renderedField{}
+	for _, f := range r.fields {
+		name := f.widget.Field.Name
+		if len(groups[name]) == 0 {
+			names = append(names, name)
+		} else if groups[name][0].widget.Type != f.widget.Type {
+			return nil, fmt.Errorf("form: field %s has widgets of different types", name)
+		}
+		groups[name] = append(groups[name], f)
+	}
+
+	annots := map[int][]string{}
+	var fields []string
+
+	for _, name := range names {
+		group := groups[name]
+		num := u.reserve()
+
+		var kids []string
+		for _, f := range group {
+			if f.page < 0 || f.page >= len(pages) {
+				return nil, fmt.Errorf("form: field %s: page not found", name)
+			}
+			page := pages[f.page]
+
+			annot := r.fieldAnnotation(u, f.widget, num, page, fonts)
+			ref := fmt.Sprintf("%d 0 R", u.add(annot))
+			kids = append(kids, ref)
+			annots[f.page] = append(annots[f.page], ref)
+		}
+
+		u.set(num, r.fieldDict(group, kids))
+		fields = append(fields, fmt.Sprintf("%d 0 R", num))
+	}
+
+	for index, refs := range annots {
+		page := pages[index]
+
+		existing := page.dict
+		v := pdfDictValue(existing, "Annots")
+		if ref, ok := pdfRef(v); ok {
+			if v, err = file.object(ref); err != nil {
+				return nil, err
+			}
+		}
+		refs = append(pdfArray(v), refs...)
+
+		u.set(page.num, pdfSetDictValue(existing, "Annots", "["+strings.Join(refs, " ")+"]"))
+	}
+
+	root, err := file.root()
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := file.object(root)
+	if err != nil {
+		return nil, err
+	}
+
+	acroForm := fmt.Sprintf("<< /Fields [%s] /DA (/Helv 0 Tf 0 g) "+
+		"/DR << /Font << /Helv %d 0 R /HeBo %d 0 R /ZaDb %d 0 R >> >> >>",
+		strings.Join(fields, " "), fonts.helv, fonts.hebo, fonts.zadb)
+	u.set(root, pdfSetDictValue(catalog, "AcroForm", acroForm))
+
+	return u.bytes(), nil
+}
+
+// fieldDict returns the field dictionary of the widgets of a field
+func (r *Renderer) fieldDict(group []*renderedField, kids []string) string {
+	w := group[0].widget
+	field := w.Field
+
+	flags := 0
+	if field.ReadOnly {
+		flags |= fieldReadOnly
+	}
+	if field.Required {
+		flags |= fieldRequired
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<< /T %s /Kids [%s]", pdfString(field.Name), strings.Join(kids, " "))
+
+	switch w.Type {
+	case "textfield":
+		if field.Multiline {
+			flags |= fieldMultiline
+		}
+		fmt.Fprintf(&b, " /FT /Tx /V %s /DA %s /Q %d", pdfString(field.Value), pdfString(fieldDA(w)), fieldQuadding(w))
+		if field.MaxLength > 0 {
+			fmt.Fprintf(&b, " /MaxLen %d", field.MaxLength)
+		}
+
+	case "select":
+		flags |= fieldCombo
+		var options []string
+		for _, option := range field.Options {
+			options = append(options, "["+pdfString(option.Value)+" "+pdfString(option.Label)+"]")
+		}
+		fmt.Fprintf(&b, " /FT /Ch /Opt [%s] /DA %s", strings.Join(options, " "), pdfString(fieldDA(w)))
+		if field.Value != "" {
+			fmt.Fprintf(&b, " /V %s", pdfString(field.Value))
+		}
+
+	case "checkbox":
+		value := "/Off"
+		if field.Checked {
+			value = "/Yes"
+		}
+		fmt.Fprintf(&b, " /FT /Btn /V %s", value)
+
+	case "radio":
+		flags |= fieldRadio | fieldNoToggleOff
+		value := "/Off"
+		for _, f := range group {
+			if f.widget.Field.Checked {
+				value = pdfName(f.widget.Field.Value)
+			}
+		}
+		fmt.Fprintf(&b, " /FT /Btn /V %s", value)
+
+	case "signatureField":
+		b.WriteString(" /FT /Sig")
+	}
+
+	if flags != 0 {
+		fmt.Fprintf(&b, " /Ff %d", flags)
+	}
+	b.WriteString(" >>")
+
+	return b.String()
+}
+
+// fieldAnnotation returns the widget annotation of a field on a page
+func (r *Renderer) fieldAnnotation(u *pdfUpdate, w *Widget, parent int, page *pdfPage, fonts fieldFonts) string {
+	c := w.Calculated
+	width := c.Width
+	height := c.Height
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<< /Type /Annot /Subtype /Widget /Parent %d 0 R /P %d 0 R /F 4 /Rect [%s %s %s %s]",
+		parent, page.num,
+		pdfNumber(c.InnerX), pdfNumber(page.height-c.InnerY-height),
+		pdfNumber(c.InnerX+width), pdfNumber(page.height-c.InnerY))
+
+	switch w.Type {
+	case "textfield", "select":
+		text := w.Field.Value
+		for _, option := range w.Field.Options {
+			if option.Value == text {
+				text = option.Label
+			}
+		}
+		fmt.Fprintf(&b, " /AP << /N %d 0 R >>", fieldTextAppearance(u, w, text, fonts))
+
+	case "checkbox", "radio":
+		// ZapfDingbats check and bullet
+		symbol, advance := "4", 0.846
+		on := "/Yes"
+		if w.Type == "radio" {
+			symbol, advance = "l", 0.791
+			on = pdfName(w.Field.Value)
+		}
+
+		size := math.Min(width, height) * 0.8
+		x := (width - size*advance) / 2
+		y := (height - size*0.7) / 2
+		stream := fmt.Sprintf("q %s BT /ZaDb %s Tf %s %s Td (%s) Tj ET Q",
+			pdfColorOp(c.Color), pdfNumber(size), pdfNumber(x), pdfNumber(y), symbol)
+
+		form := fmt.Sprintf("/Type /XObject /Subtype /Form /BBox [0 0 %s %s] /Resources << /Font << /ZaDb %d 0 R >> >>",
+			pdfNumber(width), pdfNumber(height), fonts.zadb)
+		onAppearance := u.addStream(form, []byte(stream))
+		offAppearance := u.addStream(form, nil)
+
+		state := "/Off"
+		if w.Field.Checked {
+			state = on
+		}
+
+		fmt.Fprintf(&b, " /AS %s /AP << /N << %s %d 0 R /Off %d 0 R >> >> /MK << /CA (%s) >>",
+			state, on, onAppearance, offAppearance, symbol)
+	}
+
+	b.WriteString(" >>")
+	return b.String()
+}
+
+// fieldTextAppearance adds the normal appearance of a text or choice
+// field showing its text, clipped to the field and aligned like the
+// widget. Multiline text is wrapped to the width of the field.
+func fieldTextAppearance(u *pdfUpdate, w *Widget, text string, fonts fieldFonts) int {
+	c := w.Calculated
+	width := c.Width
+	height := c.Height
+	size := c.FontSize
+	padding := 2.0
+
+	var lines []string
+	if w.Field.Multiline {
+		lines = wrapHelvetica(text, c.Bold, size, width-2*padding)
+	} else {
+		lines = []string{strings.ReplaceAll(text, "\n", " ")}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "/Tx BMC q %s %s %s %s re W n BT %s",
+		pdfNumber(padding/2), pdfNumber(padding/2), pdfNumber(width-padding), pdfNumber(height-padding), fieldDA(w))
+
+	// the first line is at the top of multiline fields and centered in others
+	y := (height - size*0.7) / 2
+	if w.Field.Multiline {
+		y = height - padding - size
+	}
+	for _, line := range lines {
+		x := padding
+		switch fieldQuadding(w) {
+		case 1:
+			x = (width - helveticaWidth(line, c.Bold, size)) / 2
+		case 2:
+			x = width - padding - helveticaWidth(line, c.Bold, size)
+		}
+		fmt.Fprintf(&b, " 1 0 0 1 %s %s Tm (%s) Tj", pdfNumber(x), pdfNumber(y), winAnsiText(line))
+		y -= c.LineHeight
+	}
+	b.WriteString(" ET Q EMC")
+
+	form := fmt.Sprintf("/Type /XObject /Subtype /Form /BBox [0 0 %s %s] "+
+		"/Resources << /Font << /Helv %d 0 R /HeBo %d 0 R >> >>",
+		pdfNumber(width), pdfNumber(height), fonts.helv, fonts.hebo)
+	return u.addStream(form, []byte(b.String()))
+}
+
+// wrapHelvetica breaks a text into the lines that fit a width, keeping
+// its line breaks and the words longer than the width on their own line
+func wrapHelvetica(text string, bold bool, size, width float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			if line != "" && helveticaWidth(line+" "+word, bold, size) > width {
+				lines = append(lines, line)
+				line = ""
+			}
+			if line != "" {
+				line += " "
+			}
+			line += word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// helveticaWidth returns the width of a text in Helvetica or Helvetica
+// Bold. The characters out of ASCII are measured as a digit.
+func helveticaWidth(text string, bold bool, size float64) float64 {
+	widths := helveticaWidths
+	if bold {
+		widths = helveticaBoldWidths
+	}
+
+	total := 0
+	for _, c := range text {
+		if c >= 32 && c < 127 {
+			total += widths[c-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// helveticaWidths are the widths of the ASCII characters from the space
+// in the standard Helvetica fonts, in thousandths of the font size
+var (
+	helveticaWidths = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+// fieldDA returns the operators of the default appearance of the text of
+// a field: the standard font, bold or not, its size and color
+func fieldDA(w *Widget) string {
+	font := "/Helv"
+	if w.Calculated.Bold {
+		font = "/HeBo"
+	}
+	return font + " " + pdfNumber(w.Calculated.FontSize) + " Tf " + pdfColorOp(w.Calculated.Color)
+}
+
+// fieldQuadding returns the alignment of the text of a field
+func fieldQuadding(w *Widget) int {
+	switch w.Align {
+	case "center":
+		return 1
+	case "right":
+		return 2
+	}
+	return 0
+}
+
+// pdfColorOp returns the operator that sets a fill color, black by default
+func pdfColorOp(c *Color) string {
+	if c == nil {
+		return "0 g"
+	}
+
+	if len(c.CMYK) == 4 {
+		return fmt.Sprintf("%s %s %s %s k",
+			pdfNumber(c.CMYK[0]/100), pdfNumber(c.CMYK[1]/100), pdfNumber(c.CMYK[2]/100), pdfNumber(c.CMYK[3]/100))
+	}
+
+	return fmt.Sprintf("%s %s %s rg",
+		pdfNumber(float64(c.R)/255), pdfNumber(float64(c.G)/255), pdfNumber(float64(c.B)/255))
+}
+
+// pdfNumber writes a number with up to 3 decimals
+func pdfNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
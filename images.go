@@ -0,0 +1,461 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrImageNotFound is returned by resolvers that don't know an image source
+var ErrImageNotFound = errors.New("image not found")
+
+// ImageResolver loads the bytes of an image referenced by the src attribute
+type ImageResolver interface {
+	ResolveImage(src string) ([]byte, error)
+}
+
+// DataURIResolver resolves data URIs like "data:image/png;base64,...".
+// The base64 payload may be padded or not.
+type DataURIResolver struct{}
+
+func (DataURIResolver) ResolveImage(src string) ([]byte, error) {
+	if !strings.HasPrefix(src, "data:") {
+		return nil, ErrImageNotFound
+	}
+
+	comma := strings.Index(src, ",")
+	if comma == -1 {
+		return nil, fmt.Errorf("invalid data URI: missing comma")
+	}
+
+	meta := src[len("data:"):comma]
+	payload := src[comma+1:]
+
+	if strings.HasSuffix(meta, ";base64") {
+		return decodeBase64(payload)
+	}
+
+	s, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data URI: %w", err)
+	}
+	return []byte(s), nil
+}
+
+// FileResolver reads images from the local file system. Sources are
+// relative to Root and can't reference files outside of it.
+type FileResolver struct {
+	Root string
+}
+
+func (f FileResolver) ResolveImage(src string) ([]byte, error) {
+	if f.Root == "" {
+		return nil, fmt.Errorf("file resolver: root directory not set")
+	}
+
+	if strings.Contains(src, ":") {
+		// URIs are resolved by other resolvers
+		return nil, ErrImageNotFound
+	}
+
+	root, err := filepath.Abs(f.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	// cleaning the path as absolute removes any leading ".."
+	path := filepath.Join(root, filepath.Clean(string(filepath.Separator)+filepath.FromSlash(src)))
+
+	// resolve symlinks so that they can't point outside of the root
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		realRoot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return nil, err
+		}
+		if rel, err := filepath.Rel(realRoot, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("image %s is outside of the root directory", src)
+		}
+		path = resolved
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrImageNotFound
+	}
+	return b, err
+}
+
+// AssetResolver resolves images from memory by name, like "logo.png"
+type AssetResolver map[string][]byte
+
+func (a AssetResolver) ResolveImage(src string) ([]byte, error) {
+	b, ok := a[src]
+	if !ok {
+		return nil, ErrImageNotFound
+	}
+	return b, nil
+}
+
+// MultiResolver tries each resolver in order until one finds the image
+type MultiResolver []ImageResolver
+
+func (m MultiResolver) ResolveImage(src string) ([]byte, error) {
+	for _, resolver := range m {
+		b, err := resolver.ResolveImage(src)
+		if errors.Is(err, ErrImageNotFound) {
+			continue
+		}
+		return b, err
+	}
+	return nil, ErrImageNotFound
+}
+
+// ResolveImages loads the images with a src attribute. Data URIs are
+// always resolved, other sources need a resolver.
+func ResolveImages(doc *Document, resolver ImageResolver) error {
+	return ResolveImagesWithCache(doc, resolver, nil)
+}
+
+// ResolveImagesWithCache loads the images like ResolveImages, probing
+// each distinct image once. Widgets with identical image bytes share
+// the same ImageInfo. A nil cache only deduplicates within the document.
+func ResolveImagesWithCache(doc *Document, resolver ImageResolver, cache *ImageCache) error {
+	resolvers := MultiResolver{DataURIResolver{}}
+	if resolver != nil {
+		resolvers = append(resolvers, resolver)
+	}
+
+	if cache == nil {
+		cache = NewImageCache()
+	}
+
+	var err error
+	doc.forEachWidget(func(w *Widget) {
+		if err != nil {
+			return
+		}
+
+		if len(w.Bytes) > 0 {
+			if w.ImageInfo == nil {
+				err = loadImage(w, w.Bytes, cache)
+			}
+			return
+		}
+
+		if w.Src == "" {
+			return
+		}
+
+		b, e := resolvers.ResolveImage(w.Src)
+		if e != nil {
+			err = fmt.Errorf("failed to load image %s: %w", w.Src, e)
+			return
+		}
+
+		err = loadImage(w, b, cache)
+	})
+
+	return err
+}
+
+// ImageInfo is the decoded information of an image
+type ImageInfo struct {
+	Key    string  // hash of the image bytes
+	Width  float64 // intrinsic width in points
+	Height float64 // intrinsic height in points
+}
+
+// ImageCache keeps the decoded information of images by content, so
+// that each distinct image is decoded once. It is safe for concurrent
+// use and can be shared between renders with Options.ImageCache.
+// Entries are never evicted.
+type ImageCache struct {
+	mu     sync.Mutex
+	images map[string]*cachedImage
+}
+
+type cachedImage struct {
+	info *ImageInfo
+	svg  *SVGImage
+}
+
+// NewImageCache creates an empty image cache
+func NewImageCache() *ImageCache {
+	return &ImageCache{images: map[string]*cachedImage{}}
+}
+
+func (c *ImageCache) load(b []byte) (*cachedImage, error) {
+	key := imageKey(b)
+
+	c.mu.Lock()
+	img, ok := c.images[key]
+	c.mu.Unlock()
+	if ok {
+		return img, nil
+	}
+
+	img, err := decodeImage(key, b)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.images[key] = img
+	c.mu.Unlock()
+
+	return img, nil
+}
+
+// loadImage sets the data of an image widget with its decoded
+// information. Without a cache the image is always decoded.
+func loadImage(w *Widget, b []byte, cache *ImageCache) error {
+	var img *cachedImage
+	var err error
+	if cache != nil {
+		img, err = cache.load(b)
+	} else {
+		img, err = decodeImage(imageKey(b), b)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.Bytes = b
+	w.SVG = img.svg
+	w.ImageInfo = img.info
+	return nil
+}
+
+// decodeImage parses SVG images and reads the size of raster images
+// without decoding their pixels. Raster images that can't be probed
+// are left to the PDF library.
+func decodeImage(key string, b []byte) (*cachedImage, error) {
+	img := &cachedImage{info: &ImageInfo{Key: key}}
+
+	if isSVG(b) {
+		svg, err := parseSVG(b)
+		if err != nil {
+			return nil, err
+		}
+		img.svg = svg
+		img.info.Width, img.info.Height = svg.Width, svg.Height
+		return img, nil
+	}
+
+	if width, height, ok := rasterSize(b); ok {
+		img.info.Width, img.info.Height = width, height
+	}
+
+	return img, nil
+}
+
+func imageKey(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// decodeImageData decodes the data attribute of an image: base64,
+// padded or not, or a data URI.
+func decodeImageData(v string) ([]byte, error) {
+	if strings.HasPrefix(v, "data:") {
+		return DataURIResolver{}.ResolveImage(v)
+	}
+	return decodeBase64(v)
+}
+
+func decodeBase64(v string) ([]byte, error) {
+	v = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\n', '\r', '\t':
+			return -1
+		}
+		return r
+	}, v)
+
+	v = strings.TrimRight(v, "=")
+
+	if strings.ContainsAny(v, "-_") {
+		return base64.RawURLEncoding.DecodeString(v)
+	}
+	return base64.RawStdEncoding.DecodeString(v)
+}
+
+// imageSize returns the intrinsic size of an image in points. Raster
+// images with resolution metadata are sized to their physical size,
+// otherwise a pixel is a point.
+func imageSize(w *Widget) (float64, float64, bool) {
+	if w.ImageInfo != nil {
+		info := w.ImageInfo
+		return info.Width, info.Height, info.Width > 0 && info.Height > 0
+	}
+
+	if w.SVG != nil {
+		return w.SVG.Width, w.SVG.Height, true
+	}
+
+	if len(w.Bytes) == 0 {
+		return 0, 0, false
+	}
+
+	return rasterSize(w.Bytes)
+}
+
+// rasterSize reads the size of a raster image from its header
+func rasterSize(b []byte) (float64, float64, bool) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	width := float64(config.Width)
+	height := float64(config.Height)
+
+	if dpiX, dpiY, ok := imageDPI(b); ok {
+		width = width * 72 / dpiX
+		height = height * 72 / dpiY
+	}
+
+	return width, height, true
+}
+
+// imageDPI reads the resolution of PNG (pHYs chunk) and JPEG (JFIF header) images
+func imageDPI(b []byte) (float64, float64, bool) {
+	switch {
+	case bytes.HasPrefix(b, []byte("\x89PNG\r\n\x1a\n")):
+		return pngDPI(b)
+	case bytes.HasPrefix(b, []byte{0xFF, 0xD8}):
+		return jpegDPI(b)
+	}
+	return 0, 0, false
+}
+
+func pngDPI(b []byte) (float64, float64, bool) {
+	pos := 8
+	for pos+8 <= len(b) {
+		length := int(binary.BigEndian.Uint32(b[pos:]))
+		typ := string(b[pos+4 : pos+8])
+		data := pos + 8
+
+		if typ == "IDAT" || data+length > len(b) {
+			break
+		}
+
+		// pixels per unit X, Y and the unit, 1 is the meter
+		if typ == "pHYs" && length == 9 && b[data+8] == 1 {
+			x := float64(binary.BigEndian.Uint32(b[data:])) * 0.0254
+			y := float64(binary.BigEndian.Uint32(b[data+4:])) * 0.0254
+			if x > 0 && y > 0 {
+				return x, y, true
+			}
+		}
+
+		pos = data + length + 4 // skip the CRC
+	}
+	return 0, 0, false
+}
+
+func jpegDPI(b []byte) (float64, float64, bool) {
+	// The JFIF APP0 segment follows the SOI marker
+	if len(b) < 18 || b[2] != 0xFF || b[3] != 0xE0 || string(b[6:11]) != "JFIF\x00" {
+		return 0, 0, false
+	}
+
+	units := b[13]
+	x := float64(binary.BigEndian.Uint16(b[14:]))
+	y := float64(binary.BigEndian.Uint16(b[16:]))
+	if x == 0 || y == 0 {
+		return 0, 0, false
+	}
+
+	switch units {
+	case 1: // dots per inch
+		return x, y, true
+	case 2: // dots per cm
+		return x * 2.54, y * 2.54, true
+	}
+	return 0, 0, false
+}
+
+// parseImagePosition parses an imagePosition value like "center",
+// "left top" or "25% 75%" into horizontal and vertical fractions.
+func parseImagePosition(v string) (float64, float64, error) {
+	x, y := 0.5, 0.5
+
+	parts := strings.Fields(v)
+	if len(parts) > 2 {
+		return 0, 0, fmt.Errorf("invalid imagePosition: %s", v)
+	}
+
+	for i, part := range parts {
+		switch part {
+		case "left":
+			x = 0
+		case "right":
+			x = 1
+		case "top":
+			y = 0
+		case "bottom":
+			y = 1
+		case "center":
+		default:
+			if !strings.HasSuffix(part, "%") {
+				return 0, 0, fmt.Errorf("invalid imagePosition: %s", v)
+			}
+			f, err := strconv.ParseFloat(strings.TrimSuffix(part, "%"), 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid imagePosition: %s", v)
+			}
+			if i == 0 {
+				x = f / 100
+			} else {
+				y = f / 100
+			}
+		}
+	}
+
+	return x, y, nil
+}
+
+// imagePlacement is where an image is drawn and the visible part of it
+type imagePlacement struct {
+	X, Y          float64 // top left corner of the drawn image
+	Width, Height float64 // size of the drawn image
+	Clip          bool    // if the image overflows the box and must be clipped
+}
+
+// fitImage places an image of the intrinsic size in a box according to the fit mode
+func fitImage(fit Fit, posX, posY, boxWidth, boxHeight, width, height float64) imagePlacement {
+	p := imagePlacement{Width: boxWidth, Height: boxHeight}
+
+	if width <= 0 || height <= 0 || fit == "" || fit == FitFill {
+		return p
+	}
+
+	switch fit {
+	case FitContain:
+		scale := math.Min(boxWidth/width, boxHeight/height)
+		p.Width, p.Height = width*scale, height*scale
+	case FitCover:
+		scale := math.Max(boxWidth/width, boxHeight/height)
+		p.Width, p.Height = width*scale, height*scale
+	case FitNone:
+		p.Width, p.Height = width, height
+	}
+
+	p.X = (boxWidth - p.Width) * posX
+	p.Y = (boxHeight - p.Height) * posY
+	p.Clip = p.Width > boxWidth+0.001 || p.Height > boxHeight+0.001
+	return p
+}
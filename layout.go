@@ -1,14 +1,15 @@
 package pdf
 
 import (
-	"bytes"
 	"fmt"
-	"image"
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
+	"math"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // NumberFormatter interface for locale-aware number operations
@@ -35,19 +36,75 @@ func SetLayout(document *Document, formatter NumberFormatter) *Document {
 	return document
 }
 
+const (
+	// ellipsisText is appended to text truncated with overflow="ellipsis"
+	ellipsisText = "…"
+
+	// defaultMinFontSize is the smallest font size for overflow="shrink"
+	defaultMinFontSize = 4
+
+	// shrinkFontStep is the font size decrement for overflow="shrink"
+	shrinkFontStep = 0.5
+
+	// defaultDateLayout formats the {date} placeholder
+	defaultDateLayout = "2006-01-02"
+)
+
 // Layouter handles the PDF document layout calculations
 type Layouter struct {
 	pdLibDoc  *PdfLibDoc
 	doc       *Document
 	formatter NumberFormatter
+
+	// pageOffset is the number of pages before the page being split
+	pageOffset int
+
+	// date is the value of the {date} placeholders
+	date time.Time
+
+	// reserved are the texts measured in place of the placeholders only
+	// known once the pages are split, as wide as the values they take
+	reserved map[string]string
 }
 
-// setLayout performs the main layout calculation steps
+// maxLayoutPasses limits the passes that widen the page number column of
+// the tables of contents
+const maxLayoutPasses = 3
+
+// setLayout performs the main layout calculation steps. When the page
+// numbers of a table of contents don't fit their column, the column is
+// widened and the document laid out again from a copy taken before the
+// pass, as the wider column can move the headings to other pages.
 func (l *Layouter) setLayout() {
-	l.initSizes(l.doc)
-	l.setPositions(l.doc)
-	l.splitPages(l.doc)
-	l.setPageNumbers(l.doc)
+	l.date = l.doc.Date
+	if l.date.IsZero() {
+		l.date = time.Now()
+	}
+	l.interpolateSections(l.doc)
+	l.reserved = l.reservePlaceholders(l.doc)
+
+	for pass := 1; ; pass++ {
+		var source []*Page
+		if pass < maxLayoutPasses && hasTOC(l.doc.Pages) {
+			source = l.clonePages(l.doc.Pages)
+		}
+
+		l.initSizes(l.doc)
+		l.setPositions(l.doc)
+		l.splitPages(l.doc)
+		l.setPageNumbers(l.doc)
+
+		if source == nil || !l.widenTOCNumbers(l.doc.Pages, source) {
+			break
+		}
+
+		l.doc.Pages = source
+		l.doc.Children = []*Widget{}
+		for _, page := range source {
+			l.doc.Children = append(l.doc.Children, &page.Widget)
+		}
+	}
+
 	l.makeAbsolute(l.doc)
 }
 
@@ -60,7 +117,9 @@ func (l *Layouter) setPageNumbers(doc *Document) {
 
 	for i := 0; i < len(pages); i++ {
 		page := pages[i]
-		if page.ResetPageNumbers || i == 0 {
+		// a start number restarts the numbering on the first page split from the page
+		restart := page.PageNumberStart > 0 && page.SectionPage == 1
+		if page.ResetPageNumbers || restart || i == 0 {
 			if i > 0 && len(currentGroup) > 0 {
 				groups = append(groups, currentGroup)
 			}
@@ -73,39 +132,254 @@ func (l *Layouter) setPageNumbers(doc *Document) {
 		groups = append(groups, currentGroup)
 	}
 
+	var runningHeader string
+	headingPages := map[*Widget]string{}
+
 	for _, group := range groups {
+		start := 1
+		if group[0].PageNumberStart > 0 {
+			start = group[0].PageNumberStart
+		}
+
 		for i := 0; i < len(group); i++ {
 			page := group[i]
 
-			current := fmt.Sprintf("%d", i+1)
-			total := fmt.Sprintf("%d", len(group))
+			// the running header is kept until a page has a new one
+			if w := lastRunningHeader(page.Children); w != nil {
+				runningHeader = widgetText(w)
+			}
 
-			if page.Header != nil {
-				l.interpolatePageNumbers(page.Header, current, total)
+			values := map[string]string{
+				"page":          formatPageNumber(start+i, page.PageNumberFormat),
+				"pages":         formatPageNumber(start+len(group)-1, page.PageNumberFormat),
+				"totalPages":    fmt.Sprintf("%d", len(pages)),
+				"sectionPage":   fmt.Sprintf("%d", page.SectionPage),
+				"sectionPages":  fmt.Sprintf("%d", page.SectionPages),
+				"section":       page.Title,
+				"runningHeader": runningHeader,
 			}
 
-			if page.Footer != nil {
-				l.interpolatePageNumbers(page.Footer, current, total)
+			for _, w := range page.Children {
+				w.forEach(func(w *Widget) {
+					if w.Heading > 0 {
+						headingPages[w] = values["page"]
+					}
+				})
+			}
+
+			replace := func(line string) string {
+				return interpolatePlaceholders(line, values, l.date)
+			}
+
+			for _, w := range []*Widget{page.Header, page.Footer, page.Background, page.Overlay} {
+				if w != nil {
+					l.interpolateWidget(w, replace)
+				}
+			}
+
+			for _, w := range page.Children {
+				l.interpolateWidget(w, replace)
+			}
+
+			for _, w := range page.Notes {
+				l.interpolateWidget(w, replace)
 			}
 		}
 	}
+
+	l.setTOCPageNumbers(doc, headingPages)
 }
 
-// interpolatePageNumbers replaces page number placeholders with actual values
-func (l *Layouter) interpolatePageNumbers(w *Widget, page, pages string) {
+// formatPageNumber writes a page number, roman numerals are written in
+// decimal from 4000 on
+func formatPageNumber(n int, format PageNumberFormat) string {
+	switch format {
+	case PageNumberLowerRoman:
+		return strings.ToLower(formatPageNumber(n, PageNumberUpperRoman))
+
+	case PageNumberUpperRoman:
+		if n < 1 || n >= 4000 {
+			break
+		}
+		var sb strings.Builder
+		for _, r := range romanNumerals {
+			for n >= r.value {
+				sb.WriteString(r.symbol)
+				n -= r.value
+			}
+		}
+		return sb.String()
+
+	case PageNumberLowerAlpha:
+		return strings.ToLower(formatPageNumber(n, PageNumberUpperAlpha))
+
+	case PageNumberUpperAlpha:
+		// A to Z, then AA, AB...
+		if n < 1 {
+			break
+		}
+		var letters []byte
+		for n > 0 {
+			n--
+			letters = append([]byte{byte('A' + n%26)}, letters...)
+			n /= 26
+		}
+		return string(letters)
+	}
+
+	return strconv.Itoa(n)
+}
+
+var romanNumerals = []struct {
+	value  int
+	symbol string
+}{
+	{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"},
+	{100, "C"}, {90, "XC"}, {50, "L"}, {40, "XL"},
+	{10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+}
+
+// interpolateWidget replaces the placeholders of the text of a widget and
+// its children. The text is wrapped again in the lines laid out with the
+// width reserved for the placeholders.
+func (l *Layouter) interpolateWidget(w *Widget, replace func(string) string) {
 	if w.ValueLines != nil {
+		if value := replace(w.Value); value != w.Value && !w.Calculated.Rotated {
+			w.Value = value
+			w.ValueLines = l.textLines(w)
+			return
+		}
+
 		for i := 0; i < len(w.ValueLines); i++ {
-			line := w.ValueLines[i]
-			line = strings.ReplaceAll(line, "{page}", page)
-			line = strings.ReplaceAll(line, "{pages}", pages)
-			w.ValueLines[i] = line
+			w.ValueLines[i] = replace(w.ValueLines[i])
 		}
 		return
 	}
 
 	for _, child := range w.Children {
-		l.interpolatePageNumbers(child, page, pages)
+		l.interpolateWidget(child, replace)
+	}
+}
+
+// interpolateSections replaces the placeholders known before the layout,
+// {section} and {date}, so that the text is wrapped with their values
+func (l *Layouter) interpolateSections(doc *Document) {
+	for _, page := range doc.Pages {
+		values := map[string]string{"section": page.Title}
+		replace := func(line string) string {
+			return interpolatePlaceholders(line, values, l.date)
+		}
+
+		widgets := append([]*Widget{page.Header, page.Footer, page.Background, page.Overlay, page.Watermark}, page.Children...)
+		for _, w := range append(widgets, page.variants()...) {
+			if w == nil {
+				continue
+			}
+			w.forEach(func(w *Widget) {
+				w.Value = replace(w.Value)
+				for i := range w.ValueLines {
+					w.ValueLines[i] = replace(w.ValueLines[i])
+				}
+			})
+		}
+	}
+}
+
+// reservePlaceholders returns the texts measured in place of the page
+// placeholders: numbers of four digits and the widest running header
+func (l *Layouter) reservePlaceholders(doc *Document) map[string]string {
+	var runningHeader string
+	for _, page := range doc.Pages {
+		for _, w := range page.Children {
+			w.forEach(func(w *Widget) {
+				if !w.RunningHeader {
+					return
+				}
+				if text := widgetText(w); l.measureTextWidth(10, text) > l.measureTextWidth(10, runningHeader) {
+					runningHeader = text
+				}
+			})
+		}
+	}
+
+	return map[string]string{
+		"page":          "0000",
+		"pages":         "0000",
+		"totalPages":    "0000",
+		"sectionPage":   "0000",
+		"sectionPages":  "0000",
+		"runningHeader": runningHeader,
+	}
+}
+
+// interpolatePlaceholders replaces the {name} placeholders found in values
+// and the {date} and {date:layout} placeholders, where layout is a Go time
+// layout. Other placeholders, like {carry}, are kept.
+func interpolatePlaceholders(line string, values map[string]string, date time.Time) string {
+	if !strings.Contains(line, "{") {
+		return line
+	}
+
+	var sb strings.Builder
+	for {
+		start := strings.Index(line, "{")
+		if start == -1 {
+			break
+		}
+		end := strings.Index(line[start:], "}")
+		if end == -1 {
+			break
+		}
+		end += start
+
+		name := line[start+1 : end]
+		value, ok := values[name]
+		if !ok && name == "date" {
+			value, ok = date.Format(defaultDateLayout), true
+		} else if !ok && strings.HasPrefix(name, "date:") {
+			value, ok = date.Format(name[len("date:"):]), true
+		}
+
+		sb.WriteString(line[:start])
+		if ok {
+			sb.WriteString(value)
+		} else {
+			sb.WriteString(line[start : end+1])
+		}
+		line = line[end+1:]
+	}
+	sb.WriteString(line)
+
+	return sb.String()
+}
+
+// lastRunningHeader returns the last widget marked as running header
+func lastRunningHeader(widgets []*Widget) *Widget {
+	var result *Widget
+	for _, w := range widgets {
+		if w.RunningHeader {
+			result = w
+		}
+		if child := lastRunningHeader(w.Children); child != nil {
+			result = child
+		}
+	}
+	return result
+}
+
+// widgetText returns the text of a widget and its children
+func widgetText(w *Widget) string {
+	if w.ValueLines != nil {
+		return strings.Join(w.ValueLines, " ")
+	}
+
+	var texts []string
+	for _, child := range w.Children {
+		if text := widgetText(child); text != "" {
+			texts = append(texts, text)
+		}
 	}
+	return strings.Join(texts, " ")
 }
 
 // makeAbsolute converts relative positions to absolute coordinates
@@ -120,6 +394,12 @@ func (l *Layouter) makePageAbsolute(page *Page) {
 	x := page.Calculated.X
 	y := page.Calculated.Y
 
+	for _, layer := range []*Widget{page.Background, page.Overlay} {
+		if layer != nil {
+			l.makeWidgetAbsolute(layer, 0, 0)
+		}
+	}
+
 	if page.Header != nil {
 		l.makeWidgetAbsolute(page.Header, 0, 0)
 	}
@@ -132,12 +412,24 @@ func (l *Layouter) makePageAbsolute(page *Page) {
 		bottom := page.Calculated.OuterHeight - page.Footer.Calculated.OuterHeight - 1
 		l.makeWidgetAbsolute(page.Footer, 0, bottom)
 	}
+
+	l.makeFootnotesAbsolute(page)
 }
 
 // makeWidgetAbsolute converts widget positions to absolute coordinates
 func (l *Layouter) makeWidgetAbsolute(w *Widget, parentX, parentY float64) {
 	w.Calculated.OuterX += parentX
 	w.Calculated.OuterY += parentY
+
+	// The unrotated box of a quarter turned widget has the same center
+	// as the rotated box laid out by the parent
+	if w.Calculated.Rotated {
+		l.swapAxes(w)
+		offset := (w.Calculated.OuterHeight - w.Calculated.OuterWidth) / 2
+		w.Calculated.OuterX += offset
+		w.Calculated.OuterY -= offset
+	}
+
 	l.adjustCalculatedPosition(w)
 
 	for _, child := range w.Children {
@@ -159,6 +451,19 @@ func (l *Layouter) initSizes(doc *Document) {
 func (l *Layouter) initPageSize(page *Page) {
 	l.addjustCalculatedSize(&page.Widget)
 
+	for _, layer := range []*Widget{page.Background, page.Overlay} {
+		if layer != nil {
+			l.initLayerSize(page, layer)
+		}
+	}
+
+	if page.Watermark != nil {
+		l.initCalculatedInfo(page.Watermark, &page.Widget)
+		if page.Watermark.Value == "" {
+			l.initImageSizeWidget(page.Watermark)
+		}
+	}
+
 	if page.Header != nil {
 		l.initCalculatedInfo(page.Header, &page.Widget)
 		l.initWidgetSize(page.Header, page.Calculated.OuterWidth)
@@ -166,12 +471,36 @@ func (l *Layouter) initPageSize(page *Page) {
 
 	for _, w := range page.Children {
 		l.initWidgetSize(w, page.Calculated.InnerWidth)
+
+		for _, note := range widgetFootnotes(w) {
+			l.initCalculatedInfo(note, &page.Widget)
+			l.initWidgetSize(note, page.Calculated.InnerWidth)
+		}
 	}
 
 	if page.Footer != nil {
 		l.initCalculatedInfo(page.Footer, &page.Widget)
 		l.initWidgetSize(page.Footer, page.Calculated.OuterWidth)
 	}
+
+	for _, w := range page.variants() {
+		l.initCalculatedInfo(w, &page.Widget)
+		l.initWidgetSize(w, page.Calculated.OuterWidth)
+	}
+}
+
+// initLayerSize sizes a background or overlay to cover the whole page
+func (l *Layouter) initLayerSize(page *Page, w *Widget) {
+	if w.Width == 0 {
+		w.Width = page.Calculated.OuterWidth
+	}
+
+	if w.Height == 0 {
+		w.Height = page.Calculated.OuterHeight
+	}
+
+	l.initCalculatedInfo(w, &page.Widget)
+	l.initWidgetSize(w, page.Calculated.OuterWidth)
 }
 
 // initWidgetSize initializes size calculations for a widget
@@ -184,12 +513,34 @@ func (l *Layouter) initWidgetSize(w *Widget, innerWidth float64) {
 
 // initFixedSizes initializes fixed dimensions for widgets
 func (l *Layouter) initFixedSizes(w *Widget, parentWidth float64) {
+	if isQuarterTurn(w.Rotate) {
+		l.initRotatedSize(w)
+		return
+	}
+
+	l.initWidgetFixedSizes(w, parentWidth)
+}
+
+// initWidgetFixedSizes initializes the fixed dimensions of a widget and its children
+func (l *Layouter) initWidgetFixedSizes(w *Widget, parentWidth float64) {
 	switch w.Type {
 	case "image", "qr":
 		l.initImageSizeWidget(w)
 		l.addjustCalculatedWidth(w)
 		return
 
+	case "barcode":
+		l.initBarcodeSize(w)
+		return
+
+	case "line", "rect", "circle", "ellipse", "polygon", "path":
+		l.initShapeSize(w)
+		return
+
+	case "textfield", "checkbox", "radio", "select", "signatureField":
+		l.initFieldSize(w)
+		return
+
 	case "table":
 		if w.CarryHeader != nil {
 			l.initCalculatedInfo(w.CarryHeader, w)
@@ -211,6 +562,38 @@ func (l *Layouter) initFixedSizes(w *Widget, parentWidth float64) {
 	}
 }
 
+// initRotatedSize lays out a quarter turned widget in its unrotated box,
+// sized by its content since the parent width becomes its height, then
+// swaps its axes so that the parent lays out the rotated box.
+func (l *Layouter) initRotatedSize(w *Widget) {
+	l.initWidgetFixedSizes(w, 0)
+
+	width := w.Calculated.OuterWidth
+	if w.Width == 0 {
+		width = l.getOuterWidth(w)
+	}
+
+	l.initWidgetsWidth(w, width)
+	l.reflowTexts(w)
+	l.initWidgetsHeight(w)
+
+	l.swapAxes(w)
+	w.Calculated.Rotated = true
+}
+
+// swapAxes swaps the calculated width and height of a widget
+func (l *Layouter) swapAxes(w *Widget) {
+	c := w.Calculated
+	c.Width, c.Height = c.Height, c.Width
+	c.InnerWidth, c.InnerHeight = c.InnerHeight, c.InnerWidth
+	c.OuterWidth, c.OuterHeight = c.OuterHeight, c.OuterWidth
+}
+
+// isQuarterTurn reports if a rotation swaps the width and height
+func isQuarterTurn(angle float64) bool {
+	return math.Abs(math.Mod(angle, 180)) == 90
+}
+
 // initValueSize calculates size for text content
 func (l *Layouter) initValueSize(w *Widget) {
 	if w.Width == 0 {
@@ -240,7 +623,13 @@ func (l *Layouter) splitPages(doc *Document) {
 	var pages []*Page
 
 	for _, page := range doc.Pages {
+		l.pageOffset = len(pages)
 		splitted := l.splitPage(page)
+		for i, p := range splitted {
+			l.selectHeaderFooter(p, i, len(splitted), len(pages)+i+1)
+			p.SectionPage = i + 1
+			p.SectionPages = len(splitted)
+		}
 		pages = append(pages, splitted...)
 	}
 
@@ -253,6 +642,105 @@ func (l *Layouter) splitPages(doc *Document) {
 	}
 }
 
+// selectHeaderFooter replaces the header and footer of a split page with
+// the variants that select it. Index is the position of the page among the
+// pages split from the same <page> and number its number in the document.
+func (l *Layouter) selectHeaderFooter(page *Page, index, count, number int) {
+	last := index == count-1
+
+	if w := pageVariant(page.Headers, index, last, number); w != nil {
+		page.Header = w
+	}
+	if w := pageVariant(page.Footers, index, last, number); w != nil {
+		page.Footer = w
+	}
+
+	page.Headers = nil
+	page.Footers = nil
+}
+
+// pageVariant returns the variant for a page. The first and last page
+// variants take precedence over the odd and even ones, and these over rest.
+func pageVariant(variants map[PageVariant]*Widget, index int, last bool, number int) *Widget {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	var candidates []PageVariant
+	if index == 0 {
+		candidates = append(candidates, PageFirst)
+	}
+	if last {
+		candidates = append(candidates, PageLast)
+	}
+	if number%2 == 1 {
+		candidates = append(candidates, PageOdd)
+	} else {
+		candidates = append(candidates, PageEven)
+	}
+	if index > 0 {
+		candidates = append(candidates, PageRest)
+	}
+
+	for _, on := range candidates {
+		if w := variants[on]; w != nil {
+			return w
+		}
+	}
+
+	return nil
+}
+
+// reserveHeaderFooter shrinks the content area of a split page so that it
+// doesn't overlap the header and the footer, plus their spacing, when the
+// page padding doesn't leave room for them.
+func (l *Layouter) reserveHeaderFooter(page *Page, index int) {
+	c := page.Calculated
+	number := l.pageOffset + index + 1
+
+	if h := l.reservedHeight(page.Header, page.Headers, index, number); h > 0 {
+		if top := h + page.HeaderSpacing; top > c.Y {
+			c.InnerHeight -= top - c.Y
+			c.Y = top
+		}
+	}
+
+	// the footer is placed at the bottom in makePageAbsolute
+	if h := l.reservedHeight(page.Footer, page.Footers, index, number); h > 0 {
+		if bottom := c.OuterHeight - h - 1 - page.FooterSpacing; c.Y+c.InnerHeight > bottom {
+			c.InnerHeight = bottom - c.Y
+		}
+	}
+
+	if c.InnerHeight < 0 {
+		c.InnerHeight = 0
+	}
+}
+
+// reservedHeight returns the height of the header or footer of a split
+// page. The last page variant is reserved on every page where it could be
+// selected, since the last page isn't known while splitting.
+func (l *Layouter) reservedHeight(w *Widget, variants map[PageVariant]*Widget, index, number int) float64 {
+	if v := pageVariant(variants, index, false, number); v != nil {
+		w = v
+	}
+
+	height := float64(0)
+	if w != nil {
+		height = w.Calculated.OuterHeight
+	}
+
+	if index == 0 && variants[PageFirst] != nil {
+		return height
+	}
+
+	if last := variants[PageLast]; last != nil && last.Calculated.OuterHeight > height {
+		height = last.Calculated.OuterHeight
+	}
+
+	return height
+}
+
 // splitPage splits a single page when content overflows
 func (l *Layouter) splitPage(page *Page) []*Page {
 	var pages []*Page
@@ -262,33 +750,34 @@ func (l *Layouter) splitPage(page *Page) []*Page {
 		return children[i].Calculated.OuterY < children[j].Calculated.OuterY
 	})
 
-	pageInnerHeight := page.Calculated.InnerHeight
-	pageBottom := pageInnerHeight
-
+	var pageBottom float64
 	var currentY float64
 	var currentPage *Page
 
 	for i := 0; i < len(children); i++ {
 		if currentPage == nil || currentY >= pageBottom {
 			currentY = 0
-			currentPage = l.copyPage(page, true)
+			currentPage = l.copyPage(page, true, len(pages))
 			pages = append(pages, currentPage)
+			pageBottom = currentPage.Calculated.InnerHeight
 
 			// reset Y to 0 of all childrens of the new page
 			l.resetY(children[i:], 0, page.Gap)
 		}
 
 		w := children[i]
+		notes := widgetFootnotes(w)
 
 		bottom := currentY + w.Calculated.OuterHeight
 
-		// if the widget does not fit in the space left and it is
-		// shorter than a full page, move it to the next page.
-		if len(currentPage.Children) > 0 && w.Type != "table" {
-			if bottom > pageBottom {
+		// if the widget, with its footnotes, does not fit in the space
+		// left and it is shorter than a full page, move it to the next page.
+		if len(currentPage.Children) > 0 && w.Type != "table" && w.List == nil && w.TOC == nil {
+			if bottom+footnotesHeight(currentPage, notes) > pageBottom {
 				currentY = 0
-				currentPage = l.copyPage(page, false)
+				currentPage = l.copyPage(page, false, len(pages))
 				pages = append(pages, currentPage)
+				pageBottom = currentPage.Calculated.InnerHeight
 
 				// reset Y to 0 of all childrens of the new page
 				l.resetY(children[i:], 0, page.Gap)
@@ -297,28 +786,46 @@ func (l *Layouter) splitPage(page *Page) []*Page {
 
 		currentPage.Children = append(currentPage.Children, w)
 
-		var tablePageBreak bool
+		var pageBreak bool
 
 		// Only split tables at the page root level
 		if w.Type == "table" {
 			breakMargin := w.BreakMargin
-			if bottom+breakMargin > pageBottom {
+			if bottom+breakMargin+footnotesHeight(currentPage, notes) > pageBottom {
 				result := l.splitTable(w, currentPage, currentY, page, &pages)
 				currentPage = result.currentPage
+				pageBottom = currentPage.Calculated.InnerHeight
+				notes = nil
 
 				currentY = 0
 
 				w = result.currentTable
-				tablePageBreak = result.pageBreak
+				pageBreak = result.pageBreak
+			}
+		}
+
+		// and lists and tables of contents between their items
+		if (w.List != nil || w.TOC != nil) && bottom+footnotesHeight(currentPage, notes) > pageBottom {
+			w, currentPage, pageBreak = l.splitList(w, currentPage, currentY, page, &pages)
+			pageBottom = currentPage.Calculated.InnerHeight
+			notes = nil
+			if pageBreak {
+				currentY = 0
 			}
 		}
 
+		// the notes of split tables and lists are reserved by each part
+		if len(notes) > 0 {
+			l.reserveFootnotes(currentPage, notes)
+			pageBottom = currentPage.Calculated.InnerHeight
+		}
+
 		currentY += w.Calculated.OuterHeight
 		if page.Gap > 0 {
 			currentY += page.Gap
 		}
 
-		if tablePageBreak && len(children) > i {
+		if pageBreak && len(children) > i {
 			l.resetY(children[i+1:], currentY, page.Gap)
 		}
 	}
@@ -345,7 +852,6 @@ func (l *Layouter) splitTable(w *Widget, currentPage *Page, currentY float64, pa
 	if w.Margin != nil {
 		margin = w.Margin.Top + w.Margin.Bottom
 	}
-	innerHeight := page.Calculated.InnerHeight - margin
 
 	var headerRow *Widget
 	if len(w.Columns) > 0 {
@@ -371,25 +877,62 @@ func (l *Layouter) splitTable(w *Widget, currentPage *Page, currentY float64, pa
 		var index int
 		found := false
 
-		// Filter only rows that fit
+		innerHeight := currentPage.Calculated.InnerHeight - margin
+
+		// Filter only rows that fit with their footnotes
+		var notes []*Widget
 		for i := 0; i < len(rows); i++ {
 			row := rows[i]
+			rowNotes := widgetFootnotes(row)
 
 			rowBottom := currentY + row.Calculated.OuterY + row.Calculated.OuterHeight
 
-			if rowBottom > innerHeight {
+			if rowBottom+footnotesHeight(currentPage, append(notes, rowNotes...)) > innerHeight {
 				break
 			}
 
+			notes = append(notes, rowNotes...)
 			index = i + 1
 			found = true
 		}
 
 		// No more pending rows
-		if !found {
+		if len(rows) == 0 {
 			break
 		}
 
+		if !found {
+			if len(currentPage.Children) > 1 {
+				// not even the first row fits, the table starts on the next page
+				currentPage.Children = currentPage.Children[:len(currentPage.Children)-1]
+				currentPage = l.copyPage(page, false, len(*pages))
+				*pages = append(*pages, currentPage)
+				currentPage.Children = append(currentPage.Children, currentTable)
+
+				currentTable.Calculated.OuterY = 0
+				l.adjustCalculatedY(currentTable)
+				currentY = 0
+				pageBreak = true
+				continue
+			}
+
+			// a row taller than the page overflows it
+			index = 1
+		}
+
+		// the repeated header never goes alone on a page
+		if headerRow != nil && pageIndex > 0 && index < 2 && len(rows) > 1 {
+			index = 2
+		}
+
+		notes = nil
+		for _, row := range rows[:index] {
+			notes = append(notes, widgetFootnotes(row)...)
+		}
+		if len(notes) > 0 {
+			l.reserveFootnotes(currentPage, notes)
+		}
+
 		currentRows = make([]*Widget, index)
 		copy(currentRows, rows[:index])
 
@@ -452,7 +995,7 @@ func (l *Layouter) splitTable(w *Widget, currentPage *Page, currentY float64, pa
 		l.recalculateFromInnerHeight(currentTable)
 		l.resetRowsY(currentTable)
 
-		currentPage = l.copyPage(page, false)
+		currentPage = l.copyPage(page, false, len(*pages))
 		*pages = append(*pages, currentPage)
 		currentPage.Children = append(currentPage.Children, currentTable)
 		pageIndex++
@@ -540,7 +1083,7 @@ func (l *Layouter) resetRowsY(w *Widget) {
 }
 
 // copyPage creates a copy of a page for pagination
-func (l *Layouter) copyPage(page *Page, copyReset bool) *Page {
+func (l *Layouter) copyPage(page *Page, copyReset bool, index int) *Page {
 	copy := &Page{}
 	copy.Type = "page"
 
@@ -563,8 +1106,20 @@ func (l *Layouter) copyPage(page *Page, copyReset bool) *Page {
 	copy.Calculated = l.deepCloneCalculated(page.Calculated)
 	copy.Header = l.deepCloneWidget(page.Header)
 	copy.Footer = l.deepCloneWidget(page.Footer)
+	copy.Headers = l.deepCloneVariants(page.Headers)
+	copy.Footers = l.deepCloneVariants(page.Footers)
+	copy.Title = page.Title
+	copy.PageNumberFormat = page.PageNumberFormat
+	copy.PageNumberStart = page.PageNumberStart
+	copy.HeaderSpacing = page.HeaderSpacing
+	copy.FooterSpacing = page.FooterSpacing
+	copy.Background = l.deepCloneWidget(page.Background)
+	copy.Overlay = l.deepCloneWidget(page.Overlay)
+	copy.Watermark = l.deepCloneWidget(page.Watermark)
 	copy.Children = []*Widget{}
 
+	l.reserveHeaderFooter(copy, index)
+
 	return copy
 }
 
@@ -585,18 +1140,32 @@ func (l *Layouter) setPagePositions(page *Page) {
 	page.Calculated.InnerY = 0
 	l.adjustCalculatedPositionFromInner(&page.Widget)
 
+	for _, layer := range []*Widget{page.Background, page.Overlay} {
+		if layer != nil {
+			l.setWidgetPosition(layer, 0, 0)
+		}
+	}
+
 	if page.Header != nil {
 		l.setWidgetPosition(page.Header, 0, 0)
 	}
 
 	for _, w := range page.Children {
 		l.setWidgetPosition(w, 0, 0)
+
+		for _, note := range widgetFootnotes(w) {
+			l.setWidgetPosition(note, 0, 0)
+		}
 	}
 
 	if page.Footer != nil {
 		// in makeAbsolute() is moved to the bottom
 		l.setWidgetPosition(page.Footer, 0, 0)
 	}
+
+	for _, w := range page.variants() {
+		l.setWidgetPosition(w, 0, 0)
+	}
 }
 
 // setWidgetPosition calculates position for a widget and its children
@@ -619,6 +1188,12 @@ func (l *Layouter) setWidgetPosition(w *Widget, parentX, parentY float64) {
 		return
 	}
 
+	// The children of a quarter turned widget are placed in its unrotated box
+	if w.Calculated.Rotated {
+		l.swapAxes(w)
+		defer l.swapAxes(w)
+	}
+
 	x := float64(0)
 	y := float64(0)
 
@@ -626,20 +1201,34 @@ func (l *Layouter) setWidgetPosition(w *Widget, parentX, parentY float64) {
 
 	direction := w.Calculated.Direction
 
-	if w.Align == "right" && direction == "row" {
-		width := float64(0)
-		for _, child := range w.Children {
-			width += child.Calculated.OuterWidth
-		}
-		if gap > 0 {
-			width += gap * float64(len(w.Children)-1)
-		}
-		x = w.Calculated.InnerWidth - width
+	justify := w.Justify
+	if justify == "" && w.Align == "right" && direction == "row" {
+		justify = JustifyEnd
+	}
+	if justify == "" && direction == "column" {
+		justify = valignJustify(w.VAlign)
+	}
+
+	alignItems := w.AlignItems
+	if alignItems == "" && w.Align == "right" && direction == "column" {
+		alignItems = AlignItemsEnd
+	}
+	if alignItems == "" && direction == "row" {
+		alignItems = valignItems(w.VAlign)
+	}
+
+	offset, spacing := l.justifyChildren(w, justify)
+	if direction == "column" {
+		y = offset
+	} else {
+		x = offset
 	}
 
 	for _, child := range w.Children {
-		if w.Align == "right" && direction == "column" {
-			x = w.Calculated.InnerWidth - child.Calculated.OuterWidth
+		if direction == "column" {
+			x = l.alignChild(w, child, alignItems)
+		} else {
+			y = l.alignChild(w, child, alignItems)
 		}
 
 		if child.X != 0 {
@@ -658,13 +1247,102 @@ func (l *Layouter) setWidgetPosition(w *Widget, parentX, parentY float64) {
 		l.setWidgetPosition(child, child.Calculated.OuterX, child.Calculated.OuterY)
 
 		if direction == "column" {
-			y += child.Calculated.OuterHeight + gap
+			y += child.Calculated.OuterHeight + gap + spacing
 		} else {
-			x += child.Calculated.OuterWidth + gap
+			x += child.Calculated.OuterWidth + gap + spacing
 		}
 	}
 }
 
+// valignJustify maps a vertical alignment to the main axis of a column
+func valignJustify(v VAlign) Justify {
+	switch v {
+	case VAlignMiddle:
+		return JustifyCenter
+	case VAlignBottom:
+		return JustifyEnd
+	}
+	return ""
+}
+
+// valignItems maps a vertical alignment to the cross axis of a row
+func valignItems(v VAlign) AlignItems {
+	switch v {
+	case VAlignMiddle:
+		return AlignItemsCenter
+	case VAlignBottom:
+		return AlignItemsEnd
+	}
+	return ""
+}
+
+// justifyChildren returns the offset of the first child and the extra space
+// between children along the main axis of a container.
+func (l *Layouter) justifyChildren(w *Widget, justify Justify) (float64, float64) {
+	count := len(w.Children)
+
+	var available, used float64
+	if w.Calculated.Direction == "column" {
+		available = w.Calculated.InnerHeight
+		for _, child := range w.Children {
+			used += child.Calculated.OuterHeight
+		}
+	} else {
+		available = w.Calculated.InnerWidth
+		for _, child := range w.Children {
+			used += child.Calculated.OuterWidth
+		}
+	}
+
+	if count > 1 {
+		used += w.Gap * float64(count-1)
+	}
+
+	free := available - used
+	if free <= 0 {
+		return 0, 0
+	}
+
+	switch justify {
+	case JustifyCenter:
+		return free / 2, 0
+	case JustifyEnd:
+		return free, 0
+	case JustifySpaceBetween:
+		if count > 1 {
+			return 0, free / float64(count-1)
+		}
+	case JustifySpaceAround:
+		space := free / float64(count)
+		return space / 2, space
+	}
+
+	return 0, 0
+}
+
+// alignChild returns the offset of a child along the cross axis of its container
+func (l *Layouter) alignChild(w *Widget, child *Widget, alignItems AlignItems) float64 {
+	var free float64
+	if w.Calculated.Direction == "column" {
+		free = w.Calculated.InnerWidth - child.Calculated.OuterWidth
+	} else {
+		free = w.Calculated.InnerHeight - child.Calculated.OuterHeight
+	}
+
+	if free <= 0 {
+		return 0
+	}
+
+	switch alignItems {
+	case AlignItemsCenter:
+		return free / 2
+	case AlignItemsEnd:
+		return free
+	}
+
+	return 0
+}
+
 // adjustCalculatedPositionFromInner converts inner positions to absolute positions
 func (l *Layouter) adjustCalculatedPositionFromInner(w *Widget) {
 	l.adjustCalculatedXFromInner(w)
@@ -731,6 +1409,10 @@ func (l *Layouter) adjustCalculatedY(w *Widget) {
 
 // reflowTexts handles text wrapping for widgets
 func (l *Layouter) reflowTexts(w *Widget) {
+	if w.Calculated.Rotated {
+		return
+	}
+
 	if len(w.ValueLines) > 0 {
 		l.wrapText(w)
 		return
@@ -743,32 +1425,119 @@ func (l *Layouter) reflowTexts(w *Widget) {
 
 // wrapText wraps text content to fit within widget bounds
 func (l *Layouter) wrapText(w *Widget) {
+	w.ValueLines = l.textLines(w)
+
+	if w.Height == 0 {
+		lines := len(w.ValueLines)
+		w.Calculated.InnerHeight = float64(lines) * w.Calculated.LineHeight
+		l.recalculateFromInnerHeight(w)
+	}
+}
+
+// textLines returns the text of a widget wrapped to its width
+func (l *Layouter) textLines(w *Widget) []string {
 	var buf []string
-	if w.Value != "" {
-		buf = l.splitLines(w.Value, w.Calculated.FontSize, w.Calculated.InnerWidth)
-	} else {
+	if w.Value == "" {
 		buf = []string{}
+	} else if w.Overflow == OverflowShrink {
+		buf = l.shrinkText(w)
+	} else {
+		buf = l.splitLines(w.Value, w.Calculated.FontSize, w.Calculated.InnerWidth)
+	}
+
+	if maxLines := l.maxLines(w, w.Calculated.LineHeight); maxLines > 0 && len(buf) > maxLines {
+		buf = buf[:maxLines]
+		if w.Overflow == OverflowEllipsis {
+			buf[maxLines-1] = l.ellipsis(buf[maxLines-1], w.Calculated.FontSize, w.Calculated.InnerWidth)
+		}
 	}
 
+	return buf
+}
+
+// maxLines returns the number of lines a widget can show, 0 if unlimited.
+// Fixed height widgets only limit their lines when an overflow mode is set.
+func (l *Layouter) maxLines(w *Widget, lineHeight float64) int {
+	if w.MaxLines > 0 {
+		return w.MaxLines
+	}
+
+	// the deprecated wrap is the same as one line at most
 	if w.Wrap {
-		if len(buf) > 0 {
-			w.ValueLines = buf[:1] // slice(0, 1)
-		} else {
-			w.ValueLines = []string{}
+		return 1
+	}
+
+	if w.Overflow != "" && w.Height != 0 && lineHeight > 0 {
+		lines := int(w.Calculated.InnerHeight / lineHeight)
+		if lines < 1 {
+			lines = 1
 		}
-	} else {
-		w.ValueLines = buf
+		return lines
 	}
 
-	if w.Height == 0 {
-		lines := len(w.ValueLines)
-		w.Calculated.InnerHeight = float64(lines) * w.Calculated.LineHeight
-		l.recalculateFromInnerHeight(w)
+	return 0
+}
+
+// ellipsis shortens a truncated line so that it fits with the ellipsis
+func (l *Layouter) ellipsis(line string, fontSize, availableWidth float64) string {
+	runes := []rune(line)
+	for len(runes) > 0 && l.measureTextWidth(fontSize, string(runes)+ellipsisText) > availableWidth {
+		runes = runes[:len(runes)-1]
 	}
+	return strings.TrimRight(string(runes), " ") + ellipsisText
+}
+
+// shrinkText reduces the font size of a widget, down to its minimum font size,
+// until the text fits in the lines available and returns the wrapped lines.
+func (l *Layouter) shrinkText(w *Widget) []string {
+	minFontSize := w.MinFontSize
+	if minFontSize <= 0 {
+		minFontSize = defaultMinFontSize
+	}
+
+	fontSize := w.Calculated.FontSize
+	lineHeight := w.Calculated.LineHeight
+
+	for {
+		lines := l.splitLines(w.Value, fontSize, w.Calculated.InnerWidth)
+
+		if fontSize <= minFontSize || l.textFits(w, lines, fontSize, lineHeight) {
+			w.Calculated.FontSize = fontSize
+			w.Calculated.LineHeight = lineHeight
+			return lines
+		}
+
+		next := fontSize - shrinkFontStep
+		if next < minFontSize {
+			next = minFontSize
+		}
+		lineHeight *= next / fontSize
+		fontSize = next
+	}
+}
+
+// textFits reports if the wrapped lines fit in the lines available
+// without breaking any word.
+func (l *Layouter) textFits(w *Widget, lines []string, fontSize, lineHeight float64) bool {
+	if maxLines := l.maxLines(w, lineHeight); maxLines > 0 && len(lines) > maxLines {
+		return false
+	}
+
+	for _, word := range strings.Fields(w.Value) {
+		if l.measureTextWidth(fontSize, word) > w.Calculated.InnerWidth {
+			return false
+		}
+	}
+
+	return true
 }
 
 // initWidgetsHeight calculates heights for all child widgets
 func (l *Layouter) initWidgetsHeight(w *Widget) {
+	if w.Calculated.Rotated {
+		return
+	}
+
 	for _, child := range w.Children {
 		l.initWidgetsHeight(child)
 	}
@@ -783,10 +1552,30 @@ func (l *Layouter) initWidgetsHeight(w *Widget) {
 	if w.Type == "table" {
 		l.adjustRowsHeight(w)
 	}
+
+	if w.AlignItems == AlignItemsStretch && w.Calculated.Direction == "row" {
+		l.stretchChildren(w)
+	}
+}
+
+// stretchChildren extends the auto height children of a row to its inner height
+func (l *Layouter) stretchChildren(w *Widget) {
+	for _, child := range w.Children {
+		if child.Height != 0 || child.Calculated.Rotated {
+			continue
+		}
+		child.Calculated.OuterHeight = w.Calculated.InnerHeight
+		l.recalculateFromOuterHeight(child)
+	}
 }
 
 // initWidgetsWidth calculates widths for all child widgets
 func (l *Layouter) initWidgetsWidth(w *Widget, parentWidth float64) {
+	// Quarter turned widgets are sized by their content in initRotatedSize
+	if w.Calculated.Rotated {
+		return
+	}
+
 	// If no width assigned, extend to container maximum
 	if w.Width == 0 {
 		w.Calculated.OuterWidth = parentWidth
@@ -801,13 +1590,20 @@ func (l *Layouter) initWidgetsWidth(w *Widget, parentWidth float64) {
 		}
 	}
 
+	l.initChildrenWidth(w)
+}
+
+// initChildrenWidth distributes the inner width of a widget among its children
+func (l *Layouter) initChildrenWidth(w *Widget) {
 	if w.Children == nil {
 		return
 	}
 
 	innerWidth := w.Calculated.InnerWidth
 
-	if w.Direction == "row" {
+	if w.Direction == "row" && l.isFlexRow(w) {
+		l.initFlexWidths(w)
+	} else if w.Direction == "row" {
 		sumWidth := float64(0)
 		for _, child := range w.Children {
 			sumWidth += child.Calculated.OuterWidth
@@ -852,6 +1648,15 @@ func (l *Layouter) initWidgetsWidth(w *Widget, parentWidth float64) {
 		}
 	} else {
 		for _, child := range w.Children {
+			// auto width children only take the width of their content
+			// when they are aligned, otherwise they are stretched.
+			if child.Width == 0 && w.AlignItems != "" && w.AlignItems != AlignItemsStretch {
+				width := l.getOuterWidth(child)
+				if width > 0 && width < innerWidth {
+					l.initWidgetsWidth(child, width)
+					continue
+				}
+			}
 			l.initWidgetsWidth(child, innerWidth)
 		}
 	}
@@ -861,9 +1666,90 @@ func (l *Layouter) initWidgetsWidth(w *Widget, parentWidth float64) {
 	}
 }
 
+// isFlexRow reports if the children of a row are sized by their content
+// and grow or shrink weights instead of sharing the free space evenly.
+func (l *Layouter) isFlexRow(w *Widget) bool {
+	if w.Justify != "" {
+		return true
+	}
+
+	for _, child := range w.Children {
+		if child.Grow > 0 || child.Shrink != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// initFlexWidths sizes the children of a row from their content width and
+// distributes the free space, or the overflow, by their grow and shrink weights.
+func (l *Layouter) initFlexWidths(w *Widget) {
+	sizes := make([]float64, len(w.Children))
+
+	total := float64(0)
+	for i, child := range w.Children {
+		if child.Width != 0 {
+			sizes[i] = child.Calculated.OuterWidth
+		} else {
+			sizes[i] = l.getOuterWidth(child)
+		}
+		total += sizes[i]
+	}
+
+	free := w.Calculated.InnerWidth - total
+	if len(w.Children) > 1 {
+		free -= w.Gap * float64(len(w.Children)-1)
+	}
+
+	if free > 0 {
+		grow := float64(0)
+		for _, child := range w.Children {
+			grow += child.Grow
+		}
+		if grow > 0 {
+			for i, child := range w.Children {
+				sizes[i] += free * child.Grow / grow
+			}
+		}
+	} else if free < 0 {
+		// Like CSS, the overflow is removed in proportion to the
+		// shrink weight multiplied by the base size of each child.
+		shrink := float64(0)
+		for i, child := range w.Children {
+			shrink += l.flexShrink(child) * sizes[i]
+		}
+		if shrink > 0 {
+			for i, child := range w.Children {
+				sizes[i] += free * l.flexShrink(child) * sizes[i] / shrink
+				if sizes[i] < 0 {
+					sizes[i] = 0
+				}
+			}
+		}
+	}
+
+	for i, child := range w.Children {
+		if child.Calculated.Rotated {
+			continue
+		}
+		child.Calculated.OuterWidth = sizes[i]
+		l.recalculateFromOuterWidth(child)
+		l.initChildrenWidth(child)
+	}
+}
+
+// flexShrink returns the shrink weight of a widget, 1 by default
+func (l *Layouter) flexShrink(w *Widget) float64 {
+	if w.Shrink != nil {
+		return *w.Shrink
+	}
+	return 1
+}
+
 // getHeight calculates the total height of a widget
 func (l *Layouter) getHeight(w *Widget) float64 {
-	if len(w.Children) == 0 {
+	if len(w.Children) == 0 || w.Calculated.Rotated {
 		if w.Calculated.OuterHeight != 0 {
 			return w.Calculated.OuterHeight
 		}
@@ -1036,7 +1922,7 @@ func (l *Layouter) getItemsInnerHeight(w *Widget) float64 {
 
 // getOuterWidth calculates the total outer width of a widget
 func (l *Layouter) getOuterWidth(w *Widget) float64 {
-	if len(w.Children) == 0 {
+	if len(w.Children) == 0 || w.Calculated.Rotated {
 		return w.Calculated.OuterWidth
 	}
 
@@ -1230,37 +2116,16 @@ func (l *Layouter) initImageSizeWidget(w *Widget) {
 		w.ImgHeight = w.Calculated.Height
 	}
 
-	if w.ImgWidth == 0 && w.ImgHeight == 0 {
-		if len(w.Bytes) > 0 {
-			img, _, err := image.Decode(bytes.NewReader(w.Bytes))
-			if err == nil {
-				bounds := img.Bounds()
-				w.ImgWidth = float64(bounds.Dx())
-				w.ImgHeight = float64(bounds.Dy())
-			}
-		}
-	} else if w.ImgWidth != 0 && w.ImgHeight == 0 {
-		if len(w.Bytes) > 0 {
-			img, _, err := image.Decode(bytes.NewReader(w.Bytes))
-			if err == nil {
-				bounds := img.Bounds()
-				originalWidth := float64(bounds.Dx())
-				originalHeight := float64(bounds.Dy())
-				if originalWidth > 0 {
-					w.ImgHeight = (w.ImgWidth / originalWidth) * originalHeight
-				}
-			}
-		}
-	} else if w.ImgHeight != 0 && w.ImgWidth == 0 {
-		if len(w.Bytes) > 0 {
-			img, _, err := image.Decode(bytes.NewReader(w.Bytes))
-			if err == nil {
-				bounds := img.Bounds()
-				originalWidth := float64(bounds.Dx())
-				originalHeight := float64(bounds.Dy())
-				if originalHeight > 0 {
-					w.ImgWidth = (w.ImgHeight / originalHeight) * originalWidth
-				}
+	if w.ImgWidth == 0 || w.ImgHeight == 0 {
+		originalWidth, originalHeight, ok := imageSize(w)
+		if ok {
+			if w.ImgWidth == 0 && w.ImgHeight == 0 {
+				w.ImgWidth = originalWidth
+				w.ImgHeight = originalHeight
+			} else if w.ImgWidth != 0 && originalWidth > 0 {
+				w.ImgHeight = (w.ImgWidth / originalWidth) * originalHeight
+			} else if w.ImgHeight != 0 && originalHeight > 0 {
+				w.ImgWidth = (w.ImgHeight / originalHeight) * originalWidth
 			}
 		}
 	}
@@ -1291,8 +2156,60 @@ func (l *Layouter) initImageSizeWidget(w *Widget) {
 	l.addjustCalculatedSize(w)
 }
 
-// measureTextWidth measures text width with specified font size
+// initBarcodeSize sets the size of barcodes from their modules and the
+// human readable text under linear codes.
+func (l *Layouter) initBarcodeSize(w *Widget) {
+	width, height := w.Barcode.Size()
+	if w.Barcode.ShowText && !w.Barcode.Is2D() {
+		height += w.Calculated.LineHeight
+	}
+
+	if w.Width == 0 {
+		w.Width = width
+	}
+
+	if w.Height == 0 {
+		w.Height = height
+	}
+
+	l.addjustCalculatedSize(w)
+}
+
+// initShapeSize sets the size of drawing widgets from their geometry.
+// Lines without coordinates and rects without width extend to their container.
+func (l *Layouter) initShapeSize(w *Widget) {
+	var width, height float64
+
+	switch w.Type {
+	case "line":
+		width = math.Max(w.Line.X, w.Line.X2)
+		height = math.Max(w.Line.Y, w.Line.Y2)
+		if height == 0 {
+			height = w.Stroke.Width
+		}
+
+	case "polygon", "path":
+		_, _, width, height = w.Path.Bounds()
+	}
+
+	if w.Width == 0 && width > 0 {
+		w.Width = width
+	}
+
+	if w.Height == 0 && height > 0 {
+		w.Height = height
+	}
+
+	l.addjustCalculatedSize(w)
+}
+
+// measureTextWidth measures text width with specified font size, the page
+// placeholders are measured as the texts reserved for them
 func (l *Layouter) measureTextWidth(fontSize float64, text string) float64 {
+	if l.reserved != nil && strings.Contains(text, "{") {
+		text = interpolatePlaceholders(text, l.reserved, l.date)
+	}
+
 	current := l.pdLibDoc.FontSize
 	if current != fontSize {
 		l.pdLibDoc.FontSize = fontSize
@@ -1415,6 +2332,7 @@ func (l *Layouter) deepCloneWidget(w *Widget) *Widget {
 		newCalc.Color = w.Calculated.Color
 		newCalc.Bold = w.Calculated.Bold
 		newCalc.Direction = w.Calculated.Direction
+		newCalc.Rotated = w.Calculated.Rotated
 
 		clone.Calculated = &newCalc
 	}
@@ -1512,6 +2430,90 @@ func (l *Layouter) deepCloneWidget(w *Widget) *Widget {
 	return &clone
 }
 
+// clonePages copies pages that are not laid out yet, with the widgets
+// that point to other widgets, like the entries of a table of contents,
+// pointing to their copies
+func (l *Layouter) clonePages(pages []*Page) []*Page {
+	clones := map[*Widget]*Widget{}
+	clone := func(w *Widget) *Widget {
+		if w == nil {
+			return nil
+		}
+		return l.cloneWidgetTree(w, clones)
+	}
+
+	result := make([]*Page, len(pages))
+	for i, page := range pages {
+		copy := *page
+		copy.Widget = *clone(&page.Widget)
+		copy.Header = clone(page.Header)
+		copy.Footer = clone(page.Footer)
+		copy.Background = clone(page.Background)
+		copy.Overlay = clone(page.Overlay)
+		copy.Watermark = clone(page.Watermark)
+		copy.Headers = l.deepCloneVariants(page.Headers)
+		copy.Footers = l.deepCloneVariants(page.Footers)
+		copy.Notes = nil
+		for _, note := range page.Notes {
+			copy.Notes = append(copy.Notes, clone(note))
+		}
+		result[i] = &copy
+	}
+
+	for _, page := range result {
+		for _, w := range page.Children {
+			w.forEach(func(w *Widget) {
+				if w.TOCTarget != nil {
+					w.TOCTarget = clones[w.TOCTarget]
+				}
+			})
+		}
+	}
+
+	return result
+}
+
+// cloneWidgetTree deep copies a widget with its children, notes and logo,
+// recording the copy of each widget in clones
+func (l *Layouter) cloneWidgetTree(w *Widget, clones map[*Widget]*Widget) *Widget {
+	children := w.Children
+	w.Children = nil
+	clone := l.deepCloneWidget(w)
+	w.Children = children
+	clones[w] = clone
+
+	if children != nil {
+		clone.Children = make([]*Widget, len(children))
+		for i, child := range children {
+			clone.Children[i] = l.cloneWidgetTree(child, clones)
+		}
+	}
+
+	if w.Footnotes != nil {
+		clone.Footnotes = make([]*Widget, len(w.Footnotes))
+		for i, note := range w.Footnotes {
+			clone.Footnotes[i] = l.cloneWidgetTree(note, clones)
+		}
+	}
+
+	if w.Logo != nil {
+		clone.Logo = l.cloneWidgetTree(w.Logo, clones)
+	}
+
+	return clone
+}
+
+func (l *Layouter) deepCloneVariants(variants map[PageVariant]*Widget) map[PageVariant]*Widget {
+	if variants == nil {
+		return nil
+	}
+	clone := make(map[PageVariant]*Widget, len(variants))
+	for on, w := range variants {
+		clone[on] = l.deepCloneWidget(w)
+	}
+	return clone
+}
+
 func (l *Layouter) deepCloneCalculated(c *CalculatedInfo) *CalculatedInfo {
 	if c == nil {
 		return nil
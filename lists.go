@@ -0,0 +1,260 @@
+package pdf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// listBullets are the default bullets of <ul> by nesting level
+var listBullets = []string{"•", "–", "·"}
+
+// listNumberings are the default numberings of <ol> by nesting level
+var listNumberings = []string{"1.", "a)", "i."}
+
+// List is set on <ul> and <ol> widgets, whose children are the rows of
+// their items: the marker followed by the content of the <li>. The content
+// is a column of its own, so wrapped lines hang after the marker.
+type List struct {
+	Ordered   bool    `json:"ordered,omitempty"`
+	Level     int     `json:"level"`     // nesting level, 1 for the outer list
+	Marker    string  `json:"marker"`    // bullet, or numbering like "1." or "a)"
+	Start     int     `json:"start"`     // number of the first item
+	Indent    float64 `json:"indent"`    // from the list edge to the item text
+	MarkerGap float64 `json:"markerGap"` // between the marker and the item text
+}
+
+func parseList(el *etree.Element) (*Widget, error) {
+	w, err := parseWidget(el)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &List{
+		Ordered:   el.Tag == "ol",
+		Level:     listLevel(el),
+		Indent:    parseFloatAttr(el, "indent", 18),
+		MarkerGap: parseFloatAttr(el, "markerGap", 6),
+	}
+
+	if list.MarkerGap < 0 || list.Indent < list.MarkerGap {
+		return nil, fmt.Errorf("%s: invalid indent value: %v", el.Tag, list.Indent)
+	}
+
+	if list.Ordered {
+		list.Marker = getAttrValue(el, "numbering", listNumberings[(list.Level-1)%len(listNumberings)])
+		if !strings.ContainsAny(list.Marker, "1aAiI") {
+			return nil, fmt.Errorf("ol: invalid numbering value: %s", list.Marker)
+		}
+
+		v := getAttrValue(el, "start", "1")
+		start, err := strconv.Atoi(v)
+		if err != nil || start < 1 {
+			return nil, fmt.Errorf("ol: invalid start value: %s", v)
+		}
+		list.Start = start
+	} else {
+		list.Marker = getAttrValue(el, "bullet", listBullets[(list.Level-1)%len(listBullets)])
+	}
+
+	w.Type = "div"
+	w.Direction = "column"
+	w.List = list
+	w.Children = []*Widget{}
+
+	for i, child := range el.ChildElements() {
+		if child.Tag != "li" {
+			return nil, fmt.Errorf("%s: invalid child: %s", el.Tag, child.Tag)
+		}
+
+		item, err := parseListItem(child, list, list.marker(i))
+		if err != nil {
+			return nil, err
+		}
+		w.Children = append(w.Children, item)
+	}
+
+	return w, nil
+}
+
+// listLevel counts the lists the element is nested in
+func listLevel(el *etree.Element) int {
+	level := 1
+	for parent := el.Parent(); parent != nil; parent = parent.Parent() {
+		if parent.Tag == "ul" || parent.Tag == "ol" {
+			level++
+		}
+	}
+	return level
+}
+
+// marker returns the marker of the item at index
+func (list *List) marker(index int) string {
+	if !list.Ordered {
+		return list.Marker
+	}
+
+	i := strings.IndexAny(list.Marker, "1aAiI")
+	format := map[byte]PageNumberFormat{
+		'1': PageNumberDecimal,
+		'a': PageNumberLowerAlpha,
+		'A': PageNumberUpperAlpha,
+		'i': PageNumberLowerRoman,
+		'I': PageNumberUpperRoman,
+	}[list.Marker[i]]
+
+	return list.Marker[:i] + formatPageNumber(list.Start+index, format) + list.Marker[i+1:]
+}
+
+// parseListItem creates the row of a <li>. The marker keeps its width and
+// the content takes the rest of the row. Text followed by widgets, like
+// a nested list, is moved to a div of its own above them.
+func parseListItem(el *etree.Element, list *List, marker string) (*Widget, error) {
+	div, err := parseDiv(el)
+	if err != nil {
+		return nil, err
+	}
+
+	content := &div.Widget
+	content.Type = "div"
+	if div.Direction != "" {
+		content.Direction = div.Direction
+	} else {
+		content.Direction = "column"
+	}
+	content.Grow = 1
+
+	if content.Value != "" && len(content.Children) > 0 {
+		text := &Widget{
+			Type:       "div",
+			Value:      content.Value,
+			ValueLines: content.ValueLines,
+			Footnotes:  content.Footnotes,
+		}
+		content.Value = ""
+		content.ValueLines = nil
+		content.Footnotes = nil
+		content.Children = append([]*Widget{text}, content.Children...)
+	}
+
+	shrink := float64(0)
+	markerWidget := &Widget{
+		Type:       "div",
+		Rect:       Rect{Width: list.Indent - list.MarkerGap},
+		Value:      marker,
+		ValueLines: []string{marker},
+		Align:      "right",
+		Option:     &CellOption{Align: RIGHT},
+		Shrink:     &shrink,
+		FontFamily: content.FontFamily,
+		FontSize:   content.FontSize,
+		Bold:       content.Bold,
+		Color:      content.Color,
+		LineHeight: content.LineHeight,
+	}
+
+	// the margin of the item separates the rows
+	row := &Widget{
+		Type:      "div",
+		Direction: "row",
+		Gap:       list.MarkerGap,
+		Margin:    content.Margin,
+		Children:  []*Widget{markerWidget, content},
+	}
+	content.Margin = nil
+
+	return row, nil
+}
+
+// splitList moves the items of a list, or the entries of a table of
+// contents, that don't fit in the space left on the page to copies of the
+// list on the next pages, reserving the space of the footnotes of the items
+// on the page they land on. Items are not split, an item taller than a page
+// overflows it.
+func (l *Layouter) splitList(w *Widget, currentPage *Page, currentY float64, page *Page, pages *[]*Page) (*Widget, *Page, bool) {
+	pageBreak := false
+
+	for {
+		// the margins and paddings of the list around its items
+		frame := w.Calculated.OuterHeight - w.Calculated.InnerHeight
+		available := currentPage.Calculated.InnerHeight - currentY - frame
+
+		index := 0
+		var notes []*Widget
+		for i, item := range w.Children {
+			itemNotes := widgetFootnotes(item)
+			if item.Calculated.OuterY+item.Calculated.OuterHeight+footnotesHeight(currentPage, append(notes, itemNotes...)) > available {
+				break
+			}
+			notes = append(notes, itemNotes...)
+			index = i + 1
+		}
+
+		if index == len(w.Children) {
+			l.reserveFootnotes(currentPage, notes)
+			return w, currentPage, pageBreak
+		}
+
+		if index == 0 {
+			if len(currentPage.Children) > 1 {
+				// not even the first item fits, the list starts on the next page
+				currentPage.Children = currentPage.Children[:len(currentPage.Children)-1]
+				currentPage = l.copyPage(page, false, len(*pages))
+				*pages = append(*pages, currentPage)
+				currentPage.Children = append(currentPage.Children, w)
+
+				w.Calculated.OuterY = 0
+				l.adjustCalculatedY(w)
+				currentY = 0
+				pageBreak = true
+				continue
+			}
+			index = 1
+			notes = widgetFootnotes(w.Children[0])
+		}
+
+		l.reserveFootnotes(currentPage, notes)
+
+		if index == len(w.Children) {
+			return w, currentPage, pageBreak
+		}
+
+		rest := w.Children[index:]
+		w.Children = w.Children[:index]
+		l.setListHeight(w)
+
+		children := w.Children
+		w.Children = nil
+		next := l.deepCloneWidget(w)
+		w.Children = children
+
+		// the items are moved to the top of the copy
+		offset := rest[0].Calculated.OuterY
+		for _, item := range rest {
+			item.Calculated.OuterY -= offset
+			l.adjustCalculatedY(item)
+		}
+		next.Children = rest
+		l.setListHeight(next)
+
+		next.Calculated.OuterY = 0
+		l.adjustCalculatedY(next)
+
+		currentPage = l.copyPage(page, false, len(*pages))
+		*pages = append(*pages, currentPage)
+		currentPage.Children = append(currentPage.Children, next)
+
+		w = next
+		currentY = 0
+		pageBreak = true
+	}
+}
+
+// setListHeight sets the height of a list to the bottom of its last item
+func (l *Layouter) setListHeight(w *Widget) {
+	last := w.Children[len(w.Children)-1]
+	w.Calculated.InnerHeight = last.Calculated.OuterY + last.Calculated.OuterHeight
+	l.recalculateFromInnerHeight(w)
+}
@@ -1,12 +1,11 @@
 package pdf
 
 import (
-	"bytes"
-	"encoding/base64"
 	"fmt"
-	"image/png"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/beevik/etree"
 	"github.com/skip2/go-qrcode"
@@ -17,8 +16,19 @@ const (
 	A4_HEIGHT = 842
 )
 
-// Parse parses an XML document into a PDF AST
+// Parse parses an XML document into a PDF AST. Components left by the
+// caller are expanded in a copy, includes need a loader.
 func Parse(docElement *etree.Document) (*Document, error) {
+	docElement = docElement.Copy()
+	if err := ExpandComponents(docElement, nil); err != nil {
+		return nil, err
+	}
+
+	return parse(docElement)
+}
+
+// parse parses an XML document with its components expanded
+func parse(docElement *etree.Document) (*Document, error) {
 	doc := &Document{
 		Widget: Widget{
 			Type:     "document",
@@ -38,6 +48,10 @@ func Parse(docElement *etree.Document) (*Document, error) {
 		if root.Tag != "page" {
 			page := el.CreateElement("page")
 			for _, child := range root.ChildElements() {
+				if child.Tag == "style" {
+					el.AddChild(child)
+					continue
+				}
 				page.AddChild(child)
 			}
 		} else {
@@ -48,9 +62,17 @@ func Parse(docElement *etree.Document) (*Document, error) {
 		root = el
 	}
 
+	// Style sheets are applied to the elements before parsing them
+	if err := applyStyles(root); err != nil {
+		return nil, err
+	}
+
 	// Parse document attributes
-	color := getAttrValue(root, "color", "#222")
-	doc.Color = parseColor(color)
+	color, err := parseColor(getAttrValue(root, "color", "#222"))
+	if err != nil {
+		return nil, fmt.Errorf("document: %w", err)
+	}
+	doc.Color = color
 
 	doc.FontFamily = getAttrValue(root, "fontFamily", "roboto")
 	doc.FontSize = parseFloatAttr(root, "fontSize", 14)
@@ -59,8 +81,30 @@ func Parse(docElement *etree.Document) (*Document, error) {
 	doc.Width = parseFloatAttr(root, "width", A4_WIDTH)
 	doc.Height = parseFloatAttr(root, "height", A4_HEIGHT)
 
+	switch v := FootnoteMode(getAttrValue(root, "footnotes", "")); v {
+	case "", FootnotesPage, FootnotesEnd:
+		doc.Footnotes = v
+	default:
+		return nil, fmt.Errorf("document: invalid footnotes value: %s", v)
+	}
+
+	if v := getAttrValue(root, "date", ""); v != "" {
+		date, err := parseDate(v)
+		if err != nil {
+			return nil, fmt.Errorf("document: invalid date value: %s", v)
+		}
+		doc.Date = date
+	}
+
 	// Parse pages
+	var layers []*etree.Element
 	for _, child := range root.ChildElements() {
+		switch child.Tag {
+		case "watermark", "background", "overlay":
+			layers = append(layers, child)
+			continue
+		}
+
 		page, err := parsePage(child, doc)
 		if err != nil {
 			return nil, err
@@ -69,9 +113,50 @@ func Parse(docElement *etree.Document) (*Document, error) {
 		doc.Children = append(doc.Children, &page.Widget)
 	}
 
+	numberFootnotes(doc)
+
+	// The headings of all the pages are known to the tables of contents
+	expandTOCs(doc)
+
+	// Document layers apply to the pages without their own
+	for _, el := range layers {
+		for _, page := range doc.Pages {
+			if page.layer(el.Tag) != nil {
+				continue
+			}
+			if err := parseLayer(el, page); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	return doc, nil
 }
 
+// applyStyles removes the <style> elements of the document and applies
+// their rules to the other elements
+func applyStyles(root *etree.Element) error {
+	var css []string
+	for _, child := range root.ChildElements() {
+		if child.Tag == "style" {
+			css = append(css, child.Text())
+			root.RemoveChild(child)
+		}
+	}
+
+	if len(css) == 0 {
+		return nil
+	}
+
+	sheet, err := parseStyleSheet(strings.Join(css, "\n"))
+	if err != nil {
+		return err
+	}
+
+	sheet.apply(root)
+	return nil
+}
+
 func parsePage(el *etree.Element, doc *Document) (*Page, error) {
 	if el.Tag != "page" {
 		return nil, fmt.Errorf("expected page element, got %s", el.Tag)
@@ -94,6 +179,24 @@ func parsePage(el *etree.Element, doc *Document) (*Page, error) {
 	}
 
 	page.ResetPageNumbers = parseBoolAttr(el, "resetPageNumbers", false)
+	page.Title = getAttrValue(el, "title", "")
+
+	switch v := PageNumberFormat(getAttrValue(el, "pageNumberFormat", "")); v {
+	case "", PageNumberDecimal, PageNumberLowerRoman, PageNumberUpperRoman, PageNumberLowerAlpha, PageNumberUpperAlpha:
+		page.PageNumberFormat = v
+	default:
+		return nil, fmt.Errorf("page: invalid pageNumberFormat value: %s", v)
+	}
+
+	if v := getAttrValue(el, "pageNumberStart", ""); v != "" {
+		start, err := strconv.Atoi(v)
+		if err != nil || start < 1 {
+			return nil, fmt.Errorf("page: invalid pageNumberStart value: %s", v)
+		}
+		page.PageNumberStart = start
+	}
+	page.HeaderSpacing = parseFloatAttr(el, "headerSpacing", 0)
+	page.FooterSpacing = parseFloatAttr(el, "footerSpacing", 0)
 	page.Children = []*Widget{}
 
 	for _, child := range el.Child {
@@ -136,23 +239,11 @@ func parseToken(tk etree.Token, page *Page, textAsWidget bool) (*Widget, error)
 
 func parseElement(el *etree.Element, page *Page) (*Widget, error) {
 	switch el.Tag {
-	case "header":
-		header, err := parseDiv(el)
-		if err != nil {
-			return nil, err
-		}
-		header.Type = "div"
-		page.Header = &header.Widget
-		return nil, nil
+	case "header", "footer":
+		return nil, parseHeaderFooter(el, page)
 
-	case "footer":
-		footer, err := parseDiv(el)
-		if err != nil {
-			return nil, err
-		}
-		footer.Type = "div"
-		page.Footer = &footer.Widget
-		return nil, nil
+	case "watermark", "background", "overlay":
+		return nil, parseLayer(el, page)
 
 	case "div":
 		div, err := parseDiv(el)
@@ -170,6 +261,7 @@ func parseElement(el *etree.Element, page *Page) (*Widget, error) {
 		}
 		// Copy image-specific fields to Widget for 1:1 TypeScript compatibility
 		img.Widget.Data = img.Data
+		img.Widget.Src = img.Src
 		img.Widget.ImgWidth = img.ImgWidth
 		img.Widget.ImgHeight = img.ImgHeight
 		img.Widget.ImgMaxWidth = img.ImgMaxWidth
@@ -189,6 +281,21 @@ func parseElement(el *etree.Element, page *Page) (*Widget, error) {
 		qr.Image.Widget.ImgMaxHeight = qr.ImgMaxHeight
 		return &qr.Image.Widget, nil
 
+	case "barcode":
+		return parseBarcode(el)
+
+	case "toc":
+		return parseTOC(el)
+
+	case "ul", "ol":
+		return parseList(el)
+
+	case "textfield", "checkbox", "radio", "select", "signatureField":
+		return parseFormField(el)
+
+	case "line", "rect", "circle", "ellipse", "polygon", "path":
+		return parseShape(el)
+
 	case "table":
 		table, err := parseTable(el)
 		if err != nil {
@@ -237,11 +344,26 @@ func parseDiv(el *etree.Element) (*Div, error) {
 		switch c := child.(type) {
 		case *etree.CharData:
 			text := c.Data
+			if len(div.Footnotes) > 0 {
+				// the text continues after a footnote reference
+				text = div.Value + text
+			}
 			if strings.TrimSpace(text) != "" {
 				div.Value = text
 				div.ValueLines = splitClean(text, "\n")
 			}
 		case *etree.Element:
+			if c.Tag == "footnote" {
+				note, err := parseFootnote(c)
+				if err != nil {
+					return nil, err
+				}
+				div.Footnotes = append(div.Footnotes, note)
+				div.Value = strings.TrimRight(div.Value, " \t\n\r") + footnoteMarker
+				div.ValueLines = splitClean(div.Value, "\n")
+				continue
+			}
+
 			w, err := parseElement(c, nil)
 			if err != nil {
 				return nil, err
@@ -270,15 +392,21 @@ func parseTable(el *etree.Element) (*Table, error) {
 		CarryColumn: -1, // Initialize to -1 to indicate no carry column
 	}
 
-	table.Border = parseBorder(el, "border")
-	table.CellBorder = parseBorder(el, "cellBorder")
+	if table.Border, err = parseBorder(el, "border"); err != nil {
+		return nil, err
+	}
+	if table.CellBorder, err = parseBorder(el, "cellBorder"); err != nil {
+		return nil, err
+	}
 
 	table.CellPadding = parsePadding(el, "cellPadding")
 
 	table.BreakMargin = parseFloatAttr(el, "breakMargin", 0)
 
 	if alternateColor := getAttrValue(el, "alternateColor", ""); alternateColor != "" {
-		table.AlternateColor = parseColor(alternateColor)
+		if table.AlternateColor, err = parseColor(alternateColor); err != nil {
+			return nil, fmt.Errorf("%s: %w", el.Tag, err)
+		}
 	}
 
 	table.Columns = []*TableColumn{}
@@ -401,6 +529,9 @@ func parseTableRow(el *etree.Element, table *Table) (*TableRow, error) {
 		if err != nil {
 			return nil, err
 		}
+		if cell.VAlign == "" {
+			cell.VAlign = row.VAlign
+		}
 		row.Children = append(row.Children, &cell.Widget)
 		index++
 	}
@@ -422,6 +553,9 @@ func parseTableCell(el *etree.Element, table *Table, index int) (*TableCell, err
 	if index < len(table.Columns) {
 		column := table.Columns[index]
 		cell.Align = column.Align
+		if cell.VAlign == "" {
+			cell.VAlign = column.VAlign
+		}
 		if cell.Option == nil {
 			cell.Option = column.Option
 		}
@@ -477,13 +611,27 @@ func parseImage(el *etree.Element) (*Image, error) {
 	}
 
 	img.Data = getAttrValue(el, "data", "")
+	img.Src = getAttrValue(el, "src", "")
 	img.ImgWidth = parseFloatAttr(el, "imgWidth", 0)
 	img.ImgHeight = parseFloatAttr(el, "imgHeight", 0)
 	img.ImgMaxWidth = parseFloatAttr(el, "imgMaxWidth", 0)
 	img.ImgMaxHeight = parseFloatAttr(el, "imgMaxHeight", 0)
 
+	switch v := Fit(getAttrValue(el, "fit", "")); v {
+	case "", FitContain, FitCover, FitFill, FitNone:
+		img.Widget.Fit = v
+	default:
+		return nil, fmt.Errorf("%s: invalid fit value: %s", el.Tag, v)
+	}
+
+	img.Widget.ImagePosition = getAttrValue(el, "imagePosition", "")
+	if _, _, err := parseImagePosition(img.Widget.ImagePosition); err != nil {
+		return nil, fmt.Errorf("%s: %w", el.Tag, err)
+	}
+
 	// Also set these in the Widget fields
 	img.Widget.Data = img.Data
+	img.Widget.Src = img.Src
 	img.Widget.ImgWidth = img.ImgWidth
 	img.Widget.ImgHeight = img.ImgHeight
 	img.Widget.ImgMaxWidth = img.ImgMaxWidth
@@ -498,14 +646,15 @@ func parseImage(el *etree.Element) (*Image, error) {
 	}
 
 	if img.Data != "" {
-		encoder := base64.RawStdEncoding
-		decoded, err := encoder.DecodeString(img.Data)
+		decoded, err := decodeImageData(img.Data)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decode image data: %w", err)
 		}
 		img.Bytes = decoded
 		// Also set in Widget
-		img.Widget.Bytes = decoded
+		if err := loadImage(&img.Widget, decoded, nil); err != nil {
+			return nil, err
+		}
 	}
 
 	return img, nil
@@ -523,17 +672,37 @@ func parseQR(el *etree.Element) (*QRCode, error) {
 
 	qr.Code = getAttrValue(el, "code", "")
 	qr.Level = getAttrValue(el, "level", "high")
-	qr.Version = int(parseFloatAttr(el, "version", 9))
+	qr.Version = int(parseFloatAttr(el, "version", 0))
 	qr.Size = int(parseFloatAttr(el, "size", 150))
+	qr.Border = int(parseFloatAttr(el, "border", 0))
+	qr.Logo = getAttrValue(el, "logo", "")
+	qr.LogoSize = parseFloatAttr(el, "logoSize", 0.2)
 
 	if qr.Size == 0 {
 		qr.Size = 150
 	}
 
+	if qr.Version < 0 || qr.Version > 40 {
+		return nil, fmt.Errorf("qr: invalid version value: %d", qr.Version)
+	}
+
+	if qr.Border < 0 {
+		return nil, fmt.Errorf("qr: invalid border value: %d", qr.Border)
+	}
+
+	if qr.LogoSize <= 0 || qr.LogoSize > 0.3 {
+		return nil, fmt.Errorf("qr: invalid logoSize value: %v", qr.LogoSize)
+	}
+
+	// the error correction of the lower levels can't recover a logo
+	if lower := strings.ToLower(qr.Level); qr.Logo != "" && (lower == "low" || lower == "medium") {
+		return nil, fmt.Errorf("qr: logo requires level high or highest: %s", qr.Level)
+	}
+
 	qr.Width = float64(qr.Size)
 	qr.Height = float64(qr.Size)
 
-	// Generate QR code bytes if code is provided
+	// Generate the QR code modules if code is provided
 	if qr.Code != "" {
 		// Map level string to qrcode.RecoveryLevel
 		var level qrcode.RecoveryLevel
@@ -550,24 +719,48 @@ func parseQR(el *etree.Element) (*QRCode, error) {
 			level = qrcode.High
 		}
 
-		// Generate QR code
-		qrCode, err := qrcode.New(qr.Code, level)
+		// Generate QR code, with the smallest version that fits unless set
+		var qrCode *qrcode.QRCode
+		if qr.Version > 0 {
+			qrCode, err = qrcode.NewWithForcedVersion(qr.Code, qr.Version, level)
+		} else {
+			qrCode, err = qrcode.New(qr.Code, level)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate QR code: %w", err)
 		}
 
-		// Convert to PNG bytes
+		// The quiet zone is drawn from the border attribute
 		qrCode.DisableBorder = true
-		img := qrCode.Image(qr.Size)
+		modules := qrCode.Bitmap()
+
+		var logoModules int
+		if qr.Logo != "" {
+			var cleared int
+			logoModules, cleared = clearQRLogoArea(modules, qr.LogoSize)
+
+			// the cleared modules take at most a third of the recovery
+			// capacity, the rest is left for damage
+			n := len(modules)
+			if float64(cleared) > qrRecoveryCapacity[level]/3*float64(n*n) {
+				return nil, fmt.Errorf("qr: invalid logoSize value: %v", qr.LogoSize)
+			}
+		}
 
-		var buf bytes.Buffer
-		if err := png.Encode(&buf, img); err != nil {
-			return nil, fmt.Errorf("failed to encode QR code as PNG: %w", err)
+		// Modules are scaled to the size of the image box when rendering
+		qr.Image.Widget.Barcode = &Barcode{
+			Type:        BarcodeQR,
+			Value:       qr.Code,
+			Text:        qr.Code,
+			ModuleWidth: float64(qr.Size) / float64(len(modules)+2*qr.Border),
+			QuietZone:   float64(qr.Border),
+			Modules:     modules,
 		}
 
-		qr.Bytes = buf.Bytes()
-		qr.Image.Bytes = buf.Bytes()
-		qr.Image.Widget.Bytes = buf.Bytes()
+		if qr.Logo != "" {
+			qr.Image.Widget.Logo = &Widget{Type: "image", Src: qr.Logo}
+			qr.Image.Widget.Barcode.LogoModules = logoModules
+		}
 
 		// Set image dimensions
 		qr.ImgWidth = float64(qr.Size)
@@ -581,6 +774,318 @@ func parseQR(el *etree.Element) (*QRCode, error) {
 	return qr, nil
 }
 
+// qrRecoveryCapacity is the fraction of the codewords each error
+// correction level recovers
+var qrRecoveryCapacity = map[qrcode.RecoveryLevel]float64{
+	qrcode.Low:     0.07,
+	qrcode.Medium:  0.15,
+	qrcode.High:    0.25,
+	qrcode.Highest: 0.30,
+}
+
+// clearQRLogoArea clears the centered modules covered by a logo of the
+// given fraction of the code size and returns the side of the square in
+// modules and the number of modules cleared. The function patterns are
+// kept, to be drawn over the logo, and the error correction recovers the
+// cleared modules.
+func clearQRLogoArea(modules [][]bool, fraction float64) (int, int) {
+	n := len(modules)
+	side := int(math.Ceil(float64(n) * fraction))
+	if (n-side)%2 != 0 {
+		side++
+	}
+
+	function := qrFunctionModules(n)
+	cleared := 0
+	start := (n - side) / 2
+	for y := start; y < start+side; y++ {
+		for x := start; x < start+side; x++ {
+			if !function[y][x] {
+				modules[y][x] = false
+				cleared++
+			}
+		}
+	}
+
+	return side, cleared
+}
+
+// qrFunctionModules returns the modules of the finder, separator, timing,
+// alignment, format and version patterns of a QR code of n modules a side
+func qrFunctionModules(n int) [][]bool {
+	function := make([][]bool, n)
+	for i := range function {
+		function[i] = make([]bool, n)
+	}
+
+	mark := func(x0, y0, x1, y1 int) {
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				function[y][x] = true
+			}
+		}
+	}
+
+	// the finders with their separators and the format information
+	mark(0, 0, 8, 8)
+	mark(n-8, 0, n-1, 8)
+	mark(0, n-8, 8, n-1)
+
+	// the timing patterns
+	mark(6, 0, 6, n-1)
+	mark(0, 6, n-1, 6)
+
+	version := (n - 17) / 4
+	positions := qrAlignmentPositions(version)
+	for _, cy := range positions {
+		for _, cx := range positions {
+			// the alignment patterns don't overlap the finders
+			if (cx <= 8 && cy <= 8) || (cx >= n-8 && cy <= 8) || (cx <= 8 && cy >= n-8) {
+				continue
+			}
+			mark(cx-2, cy-2, cx+2, cy+2)
+		}
+	}
+
+	if version >= 7 {
+		mark(n-11, 0, n-9, 5)
+		mark(0, n-11, 5, n-9)
+	}
+
+	return function
+}
+
+// qrAlignmentPositions returns the coordinates of the centers of the
+// alignment patterns of a QR version, the same in both axes
+func qrAlignmentPositions(version int) []int {
+	if version < 2 {
+		return nil
+	}
+
+	count := version/7 + 2
+	step := (version*4 + count*2 + 1) / (count*2 - 2) * 2
+	if version == 32 {
+		step = 26
+	}
+
+	positions := make([]int, count)
+	positions[0] = 6
+	for i, pos := count-1, version*4+10; i > 0; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// parseHeaderFooter parses a header or footer, the on attribute sets the
+// pages of a variant, otherwise it is the default for all the pages
+func parseHeaderFooter(el *etree.Element, page *Page) error {
+	div, err := parseDiv(el)
+	if err != nil {
+		return err
+	}
+	div.Type = "div"
+
+	variants := &page.Headers
+	if el.Tag == "footer" {
+		variants = &page.Footers
+	}
+
+	switch on := PageVariant(getAttrValue(el, "on", "")); on {
+	case "", "all":
+		if el.Tag == "footer" {
+			page.Footer = &div.Widget
+		} else {
+			page.Header = &div.Widget
+		}
+	case PageFirst, PageLast, PageOdd, PageEven, PageRest:
+		if *variants == nil {
+			*variants = map[PageVariant]*Widget{}
+		}
+		(*variants)[on] = &div.Widget
+	default:
+		return fmt.Errorf("%s: invalid on value: %s", el.Tag, on)
+	}
+
+	return nil
+}
+
+// parseLayer parses the watermark, background or overlay of a page
+func parseLayer(el *etree.Element, page *Page) error {
+	if el.Tag == "watermark" {
+		w, err := parseWatermark(el)
+		if err != nil {
+			return err
+		}
+		page.Watermark = w
+		return nil
+	}
+
+	layer, err := parseDiv(el)
+	if err != nil {
+		return err
+	}
+	layer.Type = "div"
+
+	if el.Tag == "background" {
+		page.Background = &layer.Widget
+	} else {
+		page.Overlay = &layer.Widget
+	}
+	return nil
+}
+
+func parseWatermark(el *etree.Element) (*Widget, error) {
+	img, err := parseImage(el)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &img.Widget
+	w.Type = "watermark"
+	w.Data = img.Data
+	w.Src = img.Src
+	w.ImgWidth = img.ImgWidth
+	w.ImgHeight = img.ImgHeight
+
+	w.Value = getAttrValue(el, "text", strings.TrimSpace(el.Text()))
+	w.Angle = parseFloatAttr(el, "angle", -45)
+	w.Bold = parseBoolAttr(el, "bold", true)
+
+	if w.Value == "" && w.Data == "" && w.Src == "" {
+		return nil, fmt.Errorf("watermark: text or image is required")
+	}
+
+	if w.Opacity == nil {
+		opacity := 0.2
+		w.Opacity = &opacity
+	}
+
+	if w.FontSize == 0 {
+		w.FontSize = 72
+	}
+
+	if w.Color == nil {
+		w.Color = &Color{R: 128, G: 128, B: 128}
+	}
+
+	return w, nil
+}
+
+func parseBarcode(el *etree.Element) (*Widget, error) {
+	w, err := parseWidget(el)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Barcode{
+		Type:        BarcodeType(getAttrValue(el, "type", "code128")),
+		Value:       getAttrValue(el, "value", ""),
+		ModuleWidth: parseFloatAttr(el, "moduleWidth", 1),
+		BarHeight:   parseFloatAttr(el, "barHeight", 40),
+	}
+
+	switch b.Type {
+	case BarcodeCode128, BarcodeEAN13, BarcodeUPCA, BarcodeCode39, BarcodeITF, BarcodeDataMatrix, BarcodePDF417:
+	default:
+		return nil, fmt.Errorf("barcode: invalid type value: %s", b.Type)
+	}
+
+	if b.Value == "" {
+		return nil, fmt.Errorf("barcode: value is required")
+	}
+
+	if b.ModuleWidth <= 0 {
+		return nil, fmt.Errorf("barcode: invalid moduleWidth: %v", b.ModuleWidth)
+	}
+
+	b.QuietZone = parseFloatAttr(el, "quietZone", defaultQuietZone(b.Type))
+	b.ShowText = parseBoolAttr(el, "showText", !b.Is2D())
+
+	if err := encodeBarcode(b, parseBoolAttr(el, "checksum", false)); err != nil {
+		return nil, fmt.Errorf("barcode: %w", err)
+	}
+
+	w.Barcode = b
+	return w, nil
+}
+
+func parseShape(el *etree.Element) (*Widget, error) {
+	w, err := parseWidget(el)
+	if err != nil {
+		return nil, err
+	}
+
+	w.Stroke = &LineStyle{
+		Width: parseFloatAttr(el, "lineWidth", 1),
+		Color: w.StrokeColor,
+		Style: getAttrValue(el, "lineStyle", "solid"),
+	}
+
+	switch w.Stroke.Style {
+	case "solid", "dashed", "dotted", "none":
+	default:
+		return nil, fmt.Errorf("%s: invalid lineStyle value: %s", el.Tag, w.Stroke.Style)
+	}
+
+	if v := getAttrValue(el, "dash", ""); v != "" {
+		dash, err := parseNumbers(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid dash: %w", el.Tag, err)
+		}
+		w.StrokeDash = dash
+	}
+
+	if v := getAttrValue(el, "fillColor", ""); v != "" {
+		if w.FillColor, err = parseColor(v); err != nil {
+			return nil, fmt.Errorf("%s: %w", el.Tag, err)
+		}
+	}
+
+	switch el.Tag {
+	case "line":
+		w.Line = &Line{
+			LineStyle: *w.Stroke,
+			X:         parseFloatAttr(el, "x1", 0),
+			Y:         parseFloatAttr(el, "y1", 0),
+			X2:        parseFloatAttr(el, "x2", 0),
+			Y2:        parseFloatAttr(el, "y2", 0),
+		}
+
+	case "rect":
+		w.Radius = parseFloatAttr(el, "radius", 0)
+
+	case "circle":
+		if r := parseFloatAttr(el, "r", 0); r > 0 {
+			w.Width = r * 2
+			w.Height = r * 2
+		}
+
+	case "ellipse":
+		if rx := parseFloatAttr(el, "rx", 0); rx > 0 {
+			w.Width = rx * 2
+		}
+		if ry := parseFloatAttr(el, "ry", 0); ry > 0 {
+			w.Height = ry * 2
+		}
+
+	case "polygon":
+		points, err := parsePoints(getAttrValue(el, "points", ""))
+		if err != nil {
+			return nil, fmt.Errorf("polygon: invalid points: %w", err)
+		}
+		w.Path = &Path{Subpaths: []*Subpath{{Points: points, Closed: true}}}
+
+	case "path":
+		path, err := parsePathData(getAttrValue(el, "d", ""))
+		if err != nil {
+			return nil, err
+		}
+		w.Path = path
+	}
+
+	return w, nil
+}
+
 func parseWidget(el *etree.Element) (*Widget, error) {
 	w := &Widget{
 		Type: el.Tag,
@@ -600,29 +1105,89 @@ func parseWidget(el *etree.Element) (*Widget, error) {
 		w.Direction = Direction(dir)
 	}
 
+	if err := parseFlex(el, w); err != nil {
+		return nil, err
+	}
+
+	if v := getAttrValue(el, "opacity", ""); v != "" {
+		opacity, err := strconv.ParseFloat(v, 64)
+		if err != nil || opacity < 0 || opacity > 1 {
+			return nil, fmt.Errorf("%s: invalid opacity value: %s", el.Tag, v)
+		}
+		w.Opacity = &opacity
+	}
+
+	if v := getAttrValue(el, "rotate", ""); v != "" {
+		angle, err := strconv.ParseFloat(strings.TrimSuffix(v, "deg"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid rotate value: %s", el.Tag, v)
+		}
+		w.Rotate = angle
+	}
+
+	if v := getAttrValue(el, "transform", ""); v != "" {
+		m, err := parseSVGTransform(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", el.Tag, err)
+		}
+		w.Transform = m[:]
+	}
+
 	w.Hidden = parseBoolAttr(el, "hidden", false)
+	w.RunningHeader = parseBoolAttr(el, "runningHeader", false)
+
+	if err := parseHeading(el, w); err != nil {
+		return nil, err
+	}
 	w.Wrap = parseBoolAttr(el, "wrap", false)
 
+	switch v := Overflow(getAttrValue(el, "overflow", "")); v {
+	case "", OverflowClip, OverflowEllipsis, OverflowShrink:
+		w.Overflow = v
+	default:
+		return nil, fmt.Errorf("%s: invalid overflow value: %s", el.Tag, v)
+	}
+
+	w.MaxLines = int(parseFloatAttr(el, "maxLines", 0))
+	w.MinFontSize = parseFloatAttr(el, "minFontSize", 0)
+
 	w.Padding = parsePadding(el, "padding")
 	w.Margin = parseMargin(el)
 
 	// Parse alignment exactly like TypeScript: parseAlign(el, w)
 	parseAlign(el, w)
 
+	switch v := VAlign(getAttrValue(el, "valign", "")); v {
+	case "", VAlignTop, VAlignMiddle, VAlignBottom:
+		w.VAlign = v
+	default:
+		return nil, fmt.Errorf("%s: invalid valign value: %s", el.Tag, v)
+	}
+
 	parseFont(el, w)
 
-	w.Border = parseBorder(el, "border")
+	border, err := parseBorder(el, "border")
+	if err != nil {
+		return nil, err
+	}
+	w.Border = border
 
 	if bgColor := getAttrValue(el, "backgroundColor", ""); bgColor != "" {
-		w.BackgroundColor = parseColor(bgColor)
+		if w.BackgroundColor, err = parseColor(bgColor); err != nil {
+			return nil, fmt.Errorf("%s: %w", el.Tag, err)
+		}
 	}
 
 	if color := getAttrValue(el, "color", ""); color != "" {
-		w.Color = parseColor(color)
+		if w.Color, err = parseColor(color); err != nil {
+			return nil, fmt.Errorf("%s: %w", el.Tag, err)
+		}
 	}
 
 	if strokeColor := getAttrValue(el, "strokeColor", ""); strokeColor != "" {
-		w.StrokeColor = parseColor(strokeColor)
+		if w.StrokeColor, err = parseColor(strokeColor); err != nil {
+			return nil, fmt.Errorf("%s: %w", el.Tag, err)
+		}
 	}
 
 	// Parse option (align) - this is handled by parseAlign function above
@@ -631,6 +1196,40 @@ func parseWidget(el *etree.Element) (*Widget, error) {
 	return w, nil
 }
 
+func parseFlex(el *etree.Element, w *Widget) error {
+	switch v := Justify(getAttrValue(el, "justify", "")); v {
+	case "", JustifyStart, JustifyCenter, JustifyEnd, JustifySpaceBetween, JustifySpaceAround:
+		w.Justify = v
+	default:
+		return fmt.Errorf("%s: invalid justify value: %s", el.Tag, v)
+	}
+
+	switch v := AlignItems(getAttrValue(el, "alignItems", "")); v {
+	case "", AlignItemsStart, AlignItemsCenter, AlignItemsEnd, AlignItemsStretch:
+		w.AlignItems = v
+	default:
+		return fmt.Errorf("%s: invalid alignItems value: %s", el.Tag, v)
+	}
+
+	if v := getAttrValue(el, "grow", ""); v != "" {
+		grow, err := strconv.ParseFloat(v, 64)
+		if err != nil || grow < 0 {
+			return fmt.Errorf("%s: invalid grow value: %s", el.Tag, v)
+		}
+		w.Grow = grow
+	}
+
+	if v := getAttrValue(el, "shrink", ""); v != "" {
+		shrink, err := strconv.ParseFloat(v, 64)
+		if err != nil || shrink < 0 {
+			return fmt.Errorf("%s: invalid shrink value: %s", el.Tag, v)
+		}
+		w.Shrink = &shrink
+	}
+
+	return nil
+}
+
 func parsePadding(el *etree.Element, typ string) *Box {
 	if typ == "" {
 		typ = "padding"
@@ -736,7 +1335,7 @@ func parseBox(v string) *Box {
 	return box
 }
 
-func parseBorder(el *etree.Element, typ string) *Border {
+func parseBorder(el *etree.Element, typ string) (*Border, error) {
 	if typ == "" {
 		typ = "border"
 	}
@@ -745,7 +1344,10 @@ func parseBorder(el *etree.Element, typ string) *Border {
 	borderRadius := parseFloatAttr(el, typ+"Radius", 0)
 
 	if v := getAttrValue(el, typ, ""); v != "" {
-		style := parseLineStyle(v)
+		style, err := parseLineStyle(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid %s: %w", el.Tag, typ, err)
+		}
 		border = &Border{
 			Top:    style,
 			Right:  style,
@@ -756,42 +1358,50 @@ func parseBorder(el *etree.Element, typ string) *Border {
 	}
 
 	// Override with specific sides
-	if v := getAttrValue(el, typ+"Top", ""); v != "" {
-		if border == nil {
-			border = &Border{Radius: borderRadius}
+	for _, side := range []string{"Top", "Right", "Bottom", "Left"} {
+		v := getAttrValue(el, typ+side, "")
+		if v == "" {
+			continue
 		}
-		border.Top = parseLineStyle(v)
-	}
-	if v := getAttrValue(el, typ+"Right", ""); v != "" {
-		if border == nil {
-			border = &Border{Radius: borderRadius}
+
+		style, err := parseLineStyle(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid %s%s: %w", el.Tag, typ, side, err)
 		}
-		border.Right = parseLineStyle(v)
-	}
-	if v := getAttrValue(el, typ+"Bottom", ""); v != "" {
+
 		if border == nil {
 			border = &Border{Radius: borderRadius}
 		}
-		border.Bottom = parseLineStyle(v)
-	}
-	if v := getAttrValue(el, typ+"Left", ""); v != "" {
-		if border == nil {
-			border = &Border{Radius: borderRadius}
+
+		switch side {
+		case "Top":
+			border.Top = style
+		case "Right":
+			border.Right = style
+		case "Bottom":
+			border.Bottom = style
+		case "Left":
+			border.Left = style
 		}
-		border.Left = parseLineStyle(v)
 	}
 
 	if borderRadius > 0 && border == nil {
 		border = &Border{Radius: borderRadius}
 	}
 
-	return border
+	return border, nil
 }
 
-func parseLineStyle(v string) *LineStyle {
+// parseLineStyle parses "style width color", the color may contain spaces
+// like "solid 1 rgb(0 0 0)".
+func parseLineStyle(v string) (*LineStyle, error) {
 	style := &LineStyle{}
 	parts := strings.Fields(v)
 
+	if len(parts) > 3 {
+		parts = append(parts[:2], strings.Join(parts[2:], " "))
+	}
+
 	switch len(parts) {
 	case 1:
 		style.Style = parseLineStyleValue(parts[0])
@@ -801,10 +1411,14 @@ func parseLineStyle(v string) *LineStyle {
 	case 3:
 		style.Style = parseLineStyleValue(parts[0])
 		style.Width = parseFloat(parts[1])
-		style.Color = parseColor(parts[2])
+		color, err := parseColor(parts[2])
+		if err != nil {
+			return nil, err
+		}
+		style.Color = color
 	}
 
-	return style
+	return style, nil
 }
 
 func parseLineStyleValue(v string) string {
@@ -818,32 +1432,6 @@ func parseLineStyleValue(v string) string {
 	}
 }
 
-func parseColor(v string) *Color {
-	if !strings.HasPrefix(v, "#") {
-		return nil
-	}
-
-	v = v[1:]
-
-	var r, g, b int
-
-	switch len(v) {
-	case 3:
-		r = parseHex(string(v[0]) + string(v[0]))
-		g = parseHex(string(v[1]) + string(v[1]))
-		b = parseHex(string(v[2]) + string(v[2]))
-	case 6:
-		r = parseHex(v[0:2])
-		g = parseHex(v[2:4])
-		b = parseHex(v[4:6])
-	default:
-		return nil
-	}
-
-	return &Color{R: r, G: g, B: b}
-}
-
-// parseAlign - exactly like TypeScript parseAlign function
 func parseAlign(el *etree.Element, w *Widget) {
 	w.Align = getAttrValue(el, "align", "")
 	if w.Align == "" {
@@ -888,9 +1476,12 @@ func parseAlignOption(v string, defaultValue int) int {
 	return align
 }
 
-func parseHex(v string) int {
-	n, _ := strconv.ParseInt(v, 16, 32)
-	return int(n)
+// parseDate parses a date as RFC 3339 or as year-month-day
+func parseDate(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
 }
 
 // Helper functions
@@ -0,0 +1,662 @@
+package pdf
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// flattenTolerance is the maximum distance in points between a curve and
+// the straight segments that replace it
+const flattenTolerance = 0.1
+
+// Point is a 2D point in PDF units
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Subpath is a sequence of connected points. When it has controls, each
+// segment is a cubic Bézier curve with two control points, those of a
+// straight segment being at a third and two thirds of its length.
+type Subpath struct {
+	Points   []Point `json:"points"`
+	Controls []Point `json:"controls,omitempty"`
+	Closed   bool    `json:"closed,omitempty"`
+}
+
+// Path is a vector shape made of subpaths. Arcs are converted to Bézier
+// curves, which are mapped exactly by the transforms, and the curves are
+// flattened to straight segments in page coordinates by Flatten.
+type Path struct {
+	Subpaths []*Subpath `json:"subpaths"`
+}
+
+// Bounds returns the bounding box of all the points in the path
+func (p *Path) Bounds() (minX, minY, maxX, maxY float64) {
+	first := true
+	for _, sub := range p.Flatten(flattenTolerance).Subpaths {
+		for _, pt := range sub.Points {
+			if first {
+				minX, minY, maxX, maxY = pt.X, pt.Y, pt.X, pt.Y
+				first = false
+				continue
+			}
+			minX = math.Min(minX, pt.X)
+			minY = math.Min(minY, pt.Y)
+			maxX = math.Max(maxX, pt.X)
+			maxY = math.Max(maxY, pt.Y)
+		}
+	}
+	return minX, minY, maxX, maxY
+}
+
+// Translate returns a copy of the path moved by dx, dy
+func (p *Path) Translate(dx, dy float64) *Path {
+	return p.Map(func(pt Point) Point {
+		return Point{X: pt.X + dx, Y: pt.Y + dy}
+	})
+}
+
+// Map returns a copy of the path with every point transformed by fn
+func (p *Path) Map(fn func(Point) Point) *Path {
+	result := &Path{}
+	for _, sub := range p.Subpaths {
+		mapped := &Subpath{Closed: sub.Closed}
+		for _, pt := range sub.Points {
+			mapped.Points = append(mapped.Points, fn(pt))
+		}
+		for _, pt := range sub.Controls {
+			mapped.Controls = append(mapped.Controls, fn(pt))
+		}
+		result.Subpaths = append(result.Subpaths, mapped)
+	}
+	return result
+}
+
+// Flatten returns a copy of the path with the curves replaced by straight
+// segments no farther than tolerance from them
+func (p *Path) Flatten(tolerance float64) *Path {
+	result := &Path{}
+	for _, sub := range p.Subpaths {
+		if len(sub.Controls) == 0 {
+			result.Subpaths = append(result.Subpaths, sub)
+			continue
+		}
+
+		flat := &Subpath{Points: []Point{sub.Points[0]}, Closed: sub.Closed}
+		for i := 1; i < len(sub.Points); i++ {
+			p0, p1, p2, p3 := sub.Points[i-1], sub.Controls[2*i-2], sub.Controls[2*i-1], sub.Points[i]
+
+			// the distance to the chords of n segments is at most
+			// 3/4 of the largest second difference divided by n²
+			dd := math.Max(math.Hypot(p0.X-2*p1.X+p2.X, p0.Y-2*p1.Y+p2.Y),
+				math.Hypot(p1.X-2*p2.X+p3.X, p1.Y-2*p2.Y+p3.Y))
+			n := int(math.Ceil(math.Sqrt(0.75 * dd / tolerance)))
+			if n < 1 {
+				n = 1
+			}
+
+			for j := 1; j <= n; j++ {
+				t := float64(j) / float64(n)
+				mt := 1 - t
+				flat.Points = append(flat.Points, Point{
+					X: mt*mt*mt*p0.X + 3*mt*mt*t*p1.X + 3*mt*t*t*p2.X + t*t*t*p3.X,
+					Y: mt*mt*mt*p0.Y + 3*mt*mt*t*p1.Y + 3*mt*t*t*p2.Y + t*t*t*p3.Y,
+				})
+			}
+		}
+
+		// a closed curve may end where it starts
+		if last := len(flat.Points) - 1; flat.Closed && last > 0 && flat.Points[last] == flat.Points[0] {
+			flat.Points = flat.Points[:last]
+		}
+		result.Subpaths = append(result.Subpaths, flat)
+	}
+	return result
+}
+
+// lineTo adds a straight segment to the subpath
+func (sub *Subpath) lineTo(pt Point) {
+	if len(sub.Controls) > 0 {
+		c1, c2 := lineControls(sub.Points[len(sub.Points)-1], pt)
+		sub.Controls = append(sub.Controls, c1, c2)
+	}
+	sub.Points = append(sub.Points, pt)
+}
+
+// curveTo adds a cubic Bézier curve to the subpath, giving control
+// points to its straight segments the first time
+func (sub *Subpath) curveTo(c1, c2, pt Point) {
+	if len(sub.Controls) == 0 {
+		for i := 1; i < len(sub.Points); i++ {
+			l1, l2 := lineControls(sub.Points[i-1], sub.Points[i])
+			sub.Controls = append(sub.Controls, l1, l2)
+		}
+	}
+	sub.Controls = append(sub.Controls, c1, c2)
+	sub.Points = append(sub.Points, pt)
+}
+
+// lineControls returns the control points of a straight segment
+func lineControls(a, b Point) (Point, Point) {
+	return Point{a.X + (b.X-a.X)/3, a.Y + (b.Y-a.Y)/3}, Point{a.X + 2*(b.X-a.X)/3, a.Y + 2*(b.Y-a.Y)/3}
+}
+
+// arcTo adds the arc of an ellipse centered at cx, cy with its x axis
+// rotated by phi, from the angle start turning by delta, as Bézier curves
+// of at most a quarter turn each
+func (sub *Subpath) arcTo(cx, cy, rx, ry, phi, start, delta float64) {
+	cosPhi, sinPhi := math.Cos(phi), math.Sin(phi)
+	point := func(x, y float64) Point {
+		return Point{cx + rx*x*cosPhi - ry*y*sinPhi, cy + rx*x*sinPhi + ry*y*cosPhi}
+	}
+
+	n := int(math.Ceil(math.Abs(delta) / (math.Pi / 2)))
+	if n == 0 {
+		return
+	}
+	step := delta / float64(n)
+	k := 4.0 / 3 * math.Tan(step/4)
+	for i := 0; i < n; i++ {
+		a := start + float64(i)*step
+		b := a + step
+		sub.curveTo(
+			point(math.Cos(a)-k*math.Sin(a), math.Sin(a)+k*math.Cos(a)),
+			point(math.Cos(b)+k*math.Sin(b), math.Sin(b)-k*math.Cos(b)),
+			point(math.Cos(b), math.Sin(b)))
+	}
+}
+
+// rectPath returns a rectangle with optionally rounded corners
+func rectPath(x, y, width, height, radius float64) *Path {
+	radius = math.Min(radius, math.Min(width, height)/2)
+	if radius <= 0 {
+		return &Path{Subpaths: []*Subpath{{
+			Points: []Point{{x, y}, {x + width, y}, {x + width, y + height}, {x, y + height}},
+			Closed: true,
+		}}}
+	}
+
+	sub := &Subpath{Points: []Point{{x + width - radius, y}}, Closed: true}
+	corners := []struct{ cx, cy, start float64 }{
+		{x + width - radius, y + radius, -math.Pi / 2},
+		{x + width - radius, y + height - radius, 0},
+		{x + radius, y + height - radius, math.Pi / 2},
+		{x + radius, y + radius, math.Pi},
+	}
+	for i, c := range corners {
+		if i > 0 {
+			sub.lineTo(Point{c.cx + radius*math.Cos(c.start), c.cy + radius*math.Sin(c.start)})
+		}
+		sub.arcTo(c.cx, c.cy, radius, radius, 0, c.start, math.Pi/2)
+	}
+	return &Path{Subpaths: []*Subpath{sub}}
+}
+
+// ellipsePath returns an ellipse centered at cx, cy
+func ellipsePath(cx, cy, rx, ry float64) *Path {
+	sub := &Subpath{Points: []Point{{cx + rx, cy}}, Closed: true}
+	sub.arcTo(cx, cy, rx, ry, 0, 0, 2*math.Pi)
+	return &Path{Subpaths: []*Subpath{sub}}
+}
+
+// parsePoints parses a list of coordinates like "0,0 10,0 5,10"
+func parsePoints(v string) ([]Point, error) {
+	numbers, err := parseNumbers(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(numbers)%2 != 0 {
+		return nil, fmt.Errorf("odd number of coordinates: %s", v)
+	}
+
+	points := make([]Point, 0, len(numbers)/2)
+	for i := 0; i < len(numbers); i += 2 {
+		points = append(points, Point{numbers[i], numbers[i+1]})
+	}
+	return points, nil
+}
+
+// parseNumbers parses numbers separated by spaces and/or commas
+func parseNumbers(v string) ([]float64, error) {
+	s := &pathScanner{data: v}
+
+	var numbers []float64
+	for {
+		s.skipSeparators()
+		if s.done() {
+			return numbers, nil
+		}
+		n, err := s.number()
+		if err != nil {
+			return nil, err
+		}
+		numbers = append(numbers, n)
+	}
+}
+
+// parsePathData parses SVG path data (the d attribute) into a path
+func parsePathData(d string) (*Path, error) {
+	s := &pathScanner{data: d}
+	b := &pathBuilder{path: &Path{}}
+
+	var cmd byte
+	for {
+		s.skipSeparators()
+		if s.done() {
+			break
+		}
+
+		if c := s.peek(); isPathCommand(c) {
+			cmd = c
+			s.pos++
+		} else if cmd == 0 {
+			return nil, fmt.Errorf("path: expected command at %d", s.pos)
+		}
+
+		if err := b.command(cmd, s); err != nil {
+			return nil, fmt.Errorf("path: %w", err)
+		}
+
+		// A moveto followed by more coordinates is an implicit lineto
+		switch cmd {
+		case 'M':
+			cmd = 'L'
+		case 'm':
+			cmd = 'l'
+		case 'Z', 'z':
+			cmd = 0
+		}
+	}
+
+	b.flush()
+	return b.path, nil
+}
+
+func isPathCommand(c byte) bool {
+	return strings.IndexByte("MmLlHhVvCcSsQqTtAaZz", c) != -1
+}
+
+// pathBuilder keeps the state of the path being parsed
+type pathBuilder struct {
+	path    *Path
+	current *Subpath
+	x, y    float64
+	startX  float64
+	startY  float64
+	ctrlX   float64 // last control point, for the smooth curve commands
+	ctrlY   float64
+	last    byte
+}
+
+func (b *pathBuilder) command(cmd byte, s *pathScanner) error {
+	relative := cmd >= 'a' && cmd <= 'z'
+	upper := cmd
+	if relative {
+		upper = cmd - 'a' + 'A'
+	}
+
+	var ox, oy float64
+	if relative {
+		ox, oy = b.x, b.y
+	}
+
+	args, err := s.args(pathArgCount(upper))
+	if err != nil {
+		return err
+	}
+
+	switch upper {
+	case 'M':
+		b.flush()
+		b.x, b.y = ox+args[0], oy+args[1]
+		b.startX, b.startY = b.x, b.y
+		b.current = &Subpath{Points: []Point{{b.x, b.y}}}
+
+	case 'L':
+		b.lineTo(ox+args[0], oy+args[1])
+
+	case 'H':
+		b.lineTo(ox+args[0], b.y)
+
+	case 'V':
+		b.lineTo(b.x, oy+args[0])
+
+	case 'C':
+		b.cubicTo(ox+args[0], oy+args[1], ox+args[2], oy+args[3], ox+args[4], oy+args[5])
+
+	case 'S':
+		x1, y1 := b.x, b.y
+		if b.last == 'C' || b.last == 'S' {
+			x1, y1 = 2*b.x-b.ctrlX, 2*b.y-b.ctrlY
+		}
+		b.cubicTo(x1, y1, ox+args[0], oy+args[1], ox+args[2], oy+args[3])
+
+	case 'Q':
+		b.quadTo(ox+args[0], oy+args[1], ox+args[2], oy+args[3])
+
+	case 'T':
+		x1, y1 := b.x, b.y
+		if b.last == 'Q' || b.last == 'T' {
+			x1, y1 = 2*b.x-b.ctrlX, 2*b.y-b.ctrlY
+		}
+		b.quadTo(x1, y1, ox+args[0], oy+args[1])
+
+	case 'A':
+		b.arcTo(args[0], args[1], args[2], args[3] != 0, args[4] != 0, ox+args[5], oy+args[6])
+
+	case 'Z':
+		if b.current != nil {
+			b.current.Closed = true
+			b.flush()
+		}
+		b.x, b.y = b.startX, b.startY
+	}
+
+	b.last = upper
+	return nil
+}
+
+func pathArgCount(cmd byte) int {
+	switch cmd {
+	case 'M', 'L', 'T':
+		return 2
+	case 'H', 'V':
+		return 1
+	case 'C':
+		return 6
+	case 'S', 'Q':
+		return 4
+	case 'A':
+		return 7
+	default:
+		return 0
+	}
+}
+
+// flush adds the current subpath to the path
+func (b *pathBuilder) flush() {
+	if b.current != nil && len(b.current.Points) > 1 {
+		b.path.Subpaths = append(b.path.Subpaths, b.current)
+	}
+	b.current = nil
+}
+
+func (b *pathBuilder) lineTo(x, y float64) {
+	if b.current == nil {
+		b.current = &Subpath{Points: []Point{{b.x, b.y}}}
+	}
+	b.current.lineTo(Point{x, y})
+	b.x, b.y = x, y
+}
+
+func (b *pathBuilder) cubicTo(x1, y1, x2, y2, x, y float64) {
+	if b.current == nil {
+		b.current = &Subpath{Points: []Point{{b.x, b.y}}}
+	}
+	b.current.curveTo(Point{x1, y1}, Point{x2, y2}, Point{x, y})
+	b.x, b.y = x, y
+	b.ctrlX, b.ctrlY = x2, y2
+}
+
+// quadTo adds a quadratic curve as the cubic curve of the same shape
+func (b *pathBuilder) quadTo(x1, y1, x, y float64) {
+	x0, y0 := b.x, b.y
+	b.cubicTo(x0+2*(x1-x0)/3, y0+2*(y1-y0)/3, x+2*(x1-x)/3, y+2*(y1-y)/3, x, y)
+	b.ctrlX, b.ctrlY = x1, y1
+}
+
+// arcTo converts an SVG elliptical arc to Bézier curves using the endpoint to center
+// conversion of the SVG specification (appendix F.6).
+func (b *pathBuilder) arcTo(rx, ry, rotation float64, large, sweep bool, x, y float64) {
+	x1, y1 := b.x, b.y
+	if x1 == x && y1 == y {
+		return
+	}
+
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 {
+		b.lineTo(x, y)
+		return
+	}
+
+	phi := rotation * math.Pi / 180
+	cosPhi, sinPhi := math.Cos(phi), math.Sin(phi)
+
+	dx, dy := (x1-x)/2, (y1-y)/2
+	x1p := cosPhi*dx + sinPhi*dy
+	y1p := -sinPhi*dx + cosPhi*dy
+
+	// Scale up the radii when they are too small to reach the end point
+	if lambda := (x1p*x1p)/(rx*rx) + (y1p*y1p)/(ry*ry); lambda > 1 {
+		rx *= math.Sqrt(lambda)
+		ry *= math.Sqrt(lambda)
+	}
+
+	num := rx*rx*ry*ry - rx*rx*y1p*y1p - ry*ry*x1p*x1p
+	den := rx*rx*y1p*y1p + ry*ry*x1p*x1p
+	coef := 0.0
+	if den != 0 && num > 0 {
+		coef = math.Sqrt(num / den)
+	}
+	if large == sweep {
+		coef = -coef
+	}
+	cxp := coef * rx * y1p / ry
+	cyp := -coef * ry * x1p / rx
+
+	cx := cosPhi*cxp - sinPhi*cyp + (x1+x)/2
+	cy := sinPhi*cxp + cosPhi*cyp + (y1+y)/2
+
+	start := math.Atan2((y1p-cyp)/ry, (x1p-cxp)/rx)
+	end := math.Atan2((-y1p-cyp)/ry, (-x1p-cxp)/rx)
+	delta := end - start
+	if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	} else if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	}
+
+	if b.current == nil {
+		b.current = &Subpath{Points: []Point{{b.x, b.y}}}
+	}
+	b.current.arcTo(cx, cy, rx, ry, phi, start, delta)
+
+	// end exactly at the end point despite the rounding
+	b.current.Points[len(b.current.Points)-1] = Point{x, y}
+	b.x, b.y = x, y
+}
+
+// pathScanner reads numbers and commands from path data
+type pathScanner struct {
+	data string
+	pos  int
+}
+
+func (s *pathScanner) done() bool {
+	return s.pos >= len(s.data)
+}
+
+func (s *pathScanner) peek() byte {
+	return s.data[s.pos]
+}
+
+func (s *pathScanner) skipSeparators() {
+	for !s.done() {
+		switch s.peek() {
+		case ' ', '\t', '\n', '\r', ',':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+// args reads n numbers
+func (s *pathScanner) args(n int) ([]float64, error) {
+	args := make([]float64, n)
+	for i := 0; i < n; i++ {
+		s.skipSeparators()
+		if s.done() {
+			return nil, fmt.Errorf("expected %d arguments", n)
+		}
+		v, err := s.number()
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return args, nil
+}
+
+// number reads a number like "-1.5e3". A number ends at the second
+// dot or a sign that is not part of an exponent, so "0.5.5-1" is
+// read as 0.5, .5 and -1.
+func (s *pathScanner) number() (float64, error) {
+	start := s.pos
+	dot := false
+	exp := false
+
+loop:
+	for !s.done() {
+		c := s.peek()
+		switch {
+		case c >= '0' && c <= '9':
+		case (c == '-' || c == '+') && s.pos == start:
+		case (c == '-' || c == '+') && exp && (s.data[s.pos-1] == 'e' || s.data[s.pos-1] == 'E'):
+		case c == '.' && !dot && !exp:
+			dot = true
+		case (c == 'e' || c == 'E') && !exp && s.pos > start:
+			exp = true
+		default:
+			break loop
+		}
+		s.pos++
+	}
+
+	if start == s.pos {
+		return 0, fmt.Errorf("expected number at %d", s.pos)
+	}
+
+	v, err := strconv.ParseFloat(s.data[start:s.pos], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s.data[start:s.pos])
+	}
+	return v, nil
+}
+
+// ClipFill returns the path clipped to a rectangle for filling. Each
+// subpath is clipped as a polygon with the Sutherland-Hodgman algorithm.
+func (p *Path) ClipFill(minX, minY, maxX, maxY float64) *Path {
+	edges := []struct {
+		inside func(Point) bool
+		cross  func(a, b Point) Point
+	}{
+		{func(q Point) bool { return q.X >= minX }, func(a, b Point) Point { return intersectX(a, b, minX) }},
+		{func(q Point) bool { return q.X <= maxX }, func(a, b Point) Point { return intersectX(a, b, maxX) }},
+		{func(q Point) bool { return q.Y >= minY }, func(a, b Point) Point { return intersectY(a, b, minY) }},
+		{func(q Point) bool { return q.Y <= maxY }, func(a, b Point) Point { return intersectY(a, b, maxY) }},
+	}
+
+	result := &Path{}
+	for _, sub := range p.Subpaths {
+		points := sub.Points
+		for _, edge := range edges {
+			if len(points) == 0 {
+				break
+			}
+			var clipped []Point
+			prev := points[len(points)-1]
+			for _, cur := range points {
+				if edge.inside(cur) {
+					if !edge.inside(prev) {
+						clipped = append(clipped, edge.cross(prev, cur))
+					}
+					clipped = append(clipped, cur)
+				} else if edge.inside(prev) {
+					clipped = append(clipped, edge.cross(prev, cur))
+				}
+				prev = cur
+			}
+			points = clipped
+		}
+		if len(points) > 2 {
+			result.Subpaths = append(result.Subpaths, &Subpath{Points: points, Closed: true})
+		}
+	}
+	return result
+}
+
+// ClipStroke returns the visible segments of the path inside a rectangle
+// as open subpaths, clipping each segment with the Liang-Barsky algorithm.
+func (p *Path) ClipStroke(minX, minY, maxX, maxY float64) *Path {
+	result := &Path{}
+
+	for _, sub := range p.Subpaths {
+		points := sub.Points
+		if sub.Closed && len(points) > 1 {
+			points = append(points[:len(points):len(points)], points[0])
+		}
+
+		var current *Subpath
+		for i := 1; i < len(points); i++ {
+			a, b, ok := clipSegment(points[i-1], points[i], minX, minY, maxX, maxY)
+			if !ok {
+				current = nil
+				continue
+			}
+			if current == nil || current.Points[len(current.Points)-1] != a {
+				current = &Subpath{Points: []Point{a}}
+				result.Subpaths = append(result.Subpaths, current)
+			}
+			current.Points = append(current.Points, b)
+		}
+	}
+
+	return result
+}
+
+func clipSegment(a, b Point, minX, minY, maxX, maxY float64) (Point, Point, bool) {
+	dx := b.X - a.X
+	dy := b.Y - a.Y
+	t0, t1 := 0.0, 1.0
+
+	for _, c := range [][2]float64{
+		{-dx, a.X - minX},
+		{dx, maxX - a.X},
+		{-dy, a.Y - minY},
+		{dy, maxY - a.Y},
+	} {
+		p, q := c[0], c[1]
+		if p == 0 {
+			if q < 0 {
+				return a, b, false
+			}
+			continue
+		}
+		t := q / p
+		if p < 0 {
+			t0 = math.Max(t0, t)
+		} else {
+			t1 = math.Min(t1, t)
+		}
+		if t0 > t1 {
+			return a, b, false
+		}
+	}
+
+	return Point{a.X + t0*dx, a.Y + t0*dy}, Point{a.X + t1*dx, a.Y + t1*dy}, true
+}
+
+func intersectX(a, b Point, x float64) Point {
+	t := (x - a.X) / (b.X - a.X)
+	return Point{x, a.Y + t*(b.Y-a.Y)}
+}
+
+func intersectY(a, b Point, y float64) Point {
+	t := (y - a.Y) / (b.Y - a.Y)
+	return Point{a.X + t*(b.X-a.X), y}
+}
@@ -0,0 +1,628 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pdfFile reads the objects of a PDF written by the PDF library, which
+// uses a classic cross reference table and uncompressed dictionaries.
+// Only what is needed to append an incremental update is supported.
+type pdfFile struct {
+	data    []byte
+	offsets map[int]int // offset of each object by number
+	trailer string      // dictionary of the last trailer
+	xref    int         // offset of the last cross reference table
+	size    int
+}
+
+// pdfPage is a page object with the height of its media box, used to
+// convert the top left coordinates of the layout
+type pdfPage struct {
+	num    int
+	dict   string
+	height float64
+}
+
+var pdfObjectHeader = regexp.MustCompile(`^(\d+)\s+(\d+)\s+obj`)
+
+func readPDFFile(data []byte) (*pdfFile, error) {
+	f := &pdfFile{data: data, offsets: map[int]int{}}
+
+	i := bytes.LastIndex(data, []byte("startxref"))
+	if i == -1 {
+		return nil, fmt.Errorf("pdf: missing startxref")
+	}
+	fields := strings.Fields(string(data[i+len("startxref"):]))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("pdf: invalid startxref")
+	}
+	xref, err := strconv.Atoi(fields[0])
+	if err != nil || xref >= len(data) {
+		return nil, fmt.Errorf("pdf: invalid startxref: %s", fields[0])
+	}
+	f.xref = xref
+
+	if err := f.readXref(xref); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// readXref reads a cross reference table and its trailer, and the
+// previous ones. Newer entries win over the previous ones.
+func (f *pdfFile) readXref(offset int) error {
+	s := string(f.data[offset:])
+	if !strings.HasPrefix(s, "xref") {
+		return fmt.Errorf("pdf: cross reference streams are not supported")
+	}
+
+	end := strings.Index(s, "trailer")
+	if end == -1 {
+		return fmt.Errorf("pdf: missing trailer")
+	}
+
+	lines := strings.Split(strings.ReplaceAll(s[len("xref"):end], "\r", "\n"), "\n")
+	first, count := 0, 0
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 2:
+			first, _ = strconv.Atoi(fields[0])
+			count, _ = strconv.Atoi(fields[1])
+		case 3:
+			if count == 0 {
+				return fmt.Errorf("pdf: invalid cross reference table")
+			}
+			if _, ok := f.offsets[first]; !ok && fields[2] == "n" {
+				v, err := strconv.Atoi(fields[0])
+				if err != nil {
+					return fmt.Errorf("pdf: invalid cross reference entry: %s", line)
+				}
+				f.offsets[first] = v
+			}
+			first++
+			count--
+		}
+	}
+
+	start := strings.Index(s[end:], "<<")
+	if start == -1 {
+		return fmt.Errorf("pdf: invalid trailer")
+	}
+	start += end
+	n, err := pdfValueEnd(s, start)
+	if err != nil {
+		return err
+	}
+	trailer := s[start:n]
+
+	if f.trailer == "" {
+		f.trailer = trailer
+		size, err := strconv.Atoi(pdfDictValue(trailer, "Size"))
+		if err != nil {
+			return fmt.Errorf("pdf: invalid trailer size")
+		}
+		f.size = size
+	}
+
+	if prev := pdfDictValue(trailer, "Prev"); prev != "" {
+		v, err := strconv.Atoi(prev)
+		if err != nil || v >= len(f.data) {
+			return fmt.Errorf("pdf: invalid previous cross reference: %s", prev)
+		}
+		return f.readXref(v)
+	}
+
+	return nil
+}
+
+// object returns the value of an object, without its stream
+func (f *pdfFile) object(num int) (string, error) {
+	offset, ok := f.offsets[num]
+	if !ok || offset >= len(f.data) {
+		return "", fmt.Errorf("pdf: object %d not found", num)
+	}
+
+	s := string(f.data[offset:])
+	m := pdfObjectHeader.FindStringSubmatch(s)
+	if m == nil || m[1] != strconv.Itoa(num) {
+		return "", fmt.Errorf("pdf: invalid object %d", num)
+	}
+
+	start := len(m[0])
+	for start < len(s) && isPDFSpace(s[start]) {
+		start++
+	}
+
+	end, err := pdfValueEnd(s, start)
+	if err != nil {
+		return "", fmt.Errorf("pdf: object %d: %w", num, err)
+	}
+
+	return s[start:end], nil
+}
+
+// stream returns the decoded data of a stream object
+func (f *pdfFile) stream(num int) ([]byte, error) {
+	dict, err := f.object(num)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := f.offsets[num]
+	rest := f.data[offset+bytes.Index(f.data[offset:], []byte(dict))+len(dict):]
+	i := 0
+	for i < len(rest) && isPDFSpace(rest[i]) {
+		i++
+	}
+	if !bytes.HasPrefix(rest[i:], []byte("stream")) {
+		return nil, fmt.Errorf("pdf: object %d is not a stream", num)
+	}
+	i += len("stream")
+	if i < len(rest) && rest[i] == '\r' {
+		i++
+	}
+	if i < len(rest) && rest[i] == '\n' {
+		i++
+	}
+
+	length := pdfDictValue(dict, "Length")
+	if ref, ok := pdfRef(length); ok {
+		if length, err = f.object(ref); err != nil {
+			return nil, err
+		}
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	if err != nil || n < 0 || i+n > len(rest) {
+		return nil, fmt.Errorf("pdf: invalid length of stream %d", num)
+	}
+	data := rest[i : i+n]
+
+	switch filter := pdfDictValue(dict, "Filter"); filter {
+	case "":
+		return data, nil
+	case "/FlateDecode":
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("pdf: stream %d: %w", num, err)
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("pdf: unsupported filter of stream %d: %s", num, filter)
+	}
+}
+
+// root returns the number of the catalog
+func (f *pdfFile) root() (int, error) {
+	v := pdfDictValue(f.trailer, "Root")
+	num, ok := pdfRef(v)
+	if !ok {
+		return 0, fmt.Errorf("pdf: invalid root: %s", v)
+	}
+	return num, nil
+}
+
+// pages returns the pages in order, walking the page tree
+func (f *pdfFile) pages() ([]*pdfPage, error) {
+	root, err := f.root()
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := f.object(root)
+	if err != nil {
+		return nil, err
+	}
+
+	num, ok := pdfRef(pdfDictValue(catalog, "Pages"))
+	if !ok {
+		return nil, fmt.Errorf("pdf: invalid catalog")
+	}
+
+	var pages []*pdfPage
+	if err := f.addPages(num, 0, &pages, 0); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+func (f *pdfFile) addPages(num int, height float64, pages *[]*pdfPage, depth int) error {
+	if depth > 32 {
+		return fmt.Errorf("pdf: page tree too deep")
+	}
+
+	dict, err := f.object(num)
+	if err != nil {
+		return err
+	}
+
+	// the media box is inherited from the parents
+	if box := pdfArray(pdfDictValue(dict, "MediaBox")); len(box) == 4 {
+		y1, _ := strconv.ParseFloat(box[1], 64)
+		y2, _ := strconv.ParseFloat(box[3], 64)
+		height = y2 - y1
+	}
+
+	if pdfDictValue(dict, "Type") == "/Page" {
+		*pages = append(*pages, &pdfPage{num: num, dict: dict, height: height})
+		return nil
+	}
+
+	for _, kid := range pdfArray(pdfDictValue(dict, "Kids")) {
+		kidNum, ok := pdfRef(kid)
+		if !ok {
+			return fmt.Errorf("pdf: invalid page reference: %s", kid)
+		}
+		if err := f.addPages(kidNum, height, pages, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pdfUpdate appends objects to a PDF file as an incremental update, which
+// keeps the original bytes unchanged
+type pdfUpdate struct {
+	file    *pdfFile
+	objects map[int][]byte
+	next    int
+}
+
+func newPDFUpdate(file *pdfFile) *pdfUpdate {
+	return &pdfUpdate{
+		file:    file,
+		objects: map[int][]byte{},
+		next:    file.size,
+	}
+}
+
+// add appends a new object and returns its number
+func (u *pdfUpdate) add(value string) int {
+	num := u.next
+	u.next++
+	u.objects[num] = []byte(value)
+	return num
+}
+
+// reserve returns the number of an object set later
+func (u *pdfUpdate) reserve() int {
+	num := u.next
+	u.next++
+	return num
+}
+
+// set adds or replaces an object
+func (u *pdfUpdate) set(num int, value string) {
+	u.objects[num] = []byte(value)
+}
+
+// addStream appends a stream object with the entries of dict
+func (u *pdfUpdate) addStream(dict string, data []byte) int {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<< %s /Length %d >>\nstream\n", dict, len(data))
+	b.Write(data)
+	b.WriteString("\nendstream")
+
+	num := u.next
+	u.next++
+	u.objects[num] = b.Bytes()
+	return num
+}
+
+// bytes returns the original file followed by the update
+func (u *pdfUpdate) bytes() []byte {
+	var b bytes.Buffer
+	b.Write(u.file.data)
+	if len(u.file.data) > 0 && u.file.data[len(u.file.data)-1] != '\n' {
+		b.WriteByte('\n')
+	}
+
+	nums := make([]int, 0, len(u.objects))
+	for num := range u.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	offsets := map[int]int{}
+	for _, num := range nums {
+		offsets[num] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n", num)
+		b.Write(u.objects[num])
+		b.WriteString("\nendobj\n")
+	}
+
+	xref := b.Len()
+	b.WriteString("xref\n")
+	for i := 0; i < len(nums); {
+		j := i + 1
+		for j < len(nums) && nums[j] == nums[j-1]+1 {
+			j++
+		}
+		fmt.Fprintf(&b, "%d %d\n", nums[i], j-i)
+		for _, num := range nums[i:j] {
+			fmt.Fprintf(&b, "%010d 00000 n\r\n", offsets[num])
+		}
+		i = j
+	}
+
+	trailer := pdfSetDictValue(u.file.trailer, "Size", strconv.Itoa(u.next))
+	trailer = pdfSetDictValue(trailer, "Prev", strconv.Itoa(u.file.xref))
+	fmt.Fprintf(&b, "trailer\n%s\nstartxref\n%d\n%%%%EOF\n", trailer, xref)
+
+	return b.Bytes()
+}
+
+func isPDFSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0:
+		return true
+	}
+	return false
+}
+
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return isPDFSpace(c)
+}
+
+// pdfValueEnd returns the end of the value starting at s[i]
+func pdfValueEnd(s string, i int) (int, error) {
+	if i >= len(s) {
+		return 0, fmt.Errorf("unexpected end of value")
+	}
+
+	switch {
+	case strings.HasPrefix(s[i:], "<<"):
+		i += 2
+		for {
+			for i < len(s) && isPDFSpace(s[i]) {
+				i++
+			}
+			if strings.HasPrefix(s[i:], ">>") {
+				return i + 2, nil
+			}
+			end, err := pdfValueEnd(s, i)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		}
+
+	case s[i] == '[':
+		i++
+		for {
+			for i < len(s) && isPDFSpace(s[i]) {
+				i++
+			}
+			if i < len(s) && s[i] == ']' {
+				return i + 1, nil
+			}
+			end, err := pdfValueEnd(s, i)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		}
+
+	case s[i] == '(':
+		depth := 0
+		for j := i; j < len(s); j++ {
+			switch s[j] {
+			case '\\':
+				j++
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					return j + 1, nil
+				}
+			}
+		}
+		return 0, fmt.Errorf("unterminated string")
+
+	case s[i] == '<':
+		end := strings.IndexByte(s[i:], '>')
+		if end == -1 {
+			return 0, fmt.Errorf("unterminated hex string")
+		}
+		return i + end + 1, nil
+
+	case s[i] == '/':
+		j := i + 1
+		for j < len(s) && !isPDFDelimiter(s[j]) {
+			j++
+		}
+		return j, nil
+
+	case isPDFDelimiter(s[i]):
+		return 0, fmt.Errorf("unexpected %q", s[i])
+	}
+
+	j := i
+	for j < len(s) && !isPDFDelimiter(s[j]) {
+		j++
+	}
+
+	// an indirect reference is a number, a generation and R
+	if m := pdfRefSuffix.FindStringIndex(s[j:]); m != nil && isInteger(s[i:j]) {
+		return j + m[1], nil
+	}
+
+	return j, nil
+}
+
+var pdfRefSuffix = regexp.MustCompile(`^\s+\d+\s+R\b`)
+
+func isInteger(v string) bool {
+	_, err := strconv.Atoi(v)
+	return err == nil
+}
+
+// pdfDictEntries returns the keys, without slash, and values of a dictionary
+func pdfDictEntries(dict string) ([][2]string, error) {
+	if !strings.HasPrefix(dict, "<<") {
+		return nil, fmt.Errorf("pdf: not a dictionary")
+	}
+
+	var entries [][2]string
+	i := 2
+	for {
+		for i < len(dict) && isPDFSpace(dict[i]) {
+			i++
+		}
+		if i >= len(dict) {
+			return nil, fmt.Errorf("pdf: unterminated dictionary")
+		}
+		if strings.HasPrefix(dict[i:], ">>") {
+			return entries, nil
+		}
+
+		if dict[i] != '/' {
+			return nil, fmt.Errorf("pdf: invalid dictionary key")
+		}
+		keyEnd, err := pdfValueEnd(dict, i)
+		if err != nil {
+			return nil, err
+		}
+
+		start := keyEnd
+		for start < len(dict) && isPDFSpace(dict[start]) {
+			start++
+		}
+		end, err := pdfValueEnd(dict, start)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, [2]string{dict[i+1 : keyEnd], dict[start:end]})
+		i = end
+	}
+}
+
+// pdfDictValue returns the raw value of a key, empty if not found
+func pdfDictValue(dict, key string) string {
+	entries, _ := pdfDictEntries(dict)
+	for _, e := range entries {
+		if e[0] == key {
+			return e[1]
+		}
+	}
+	return ""
+}
+
+// pdfSetDictValue returns the dictionary with the value of a key replaced
+// or added, an empty value removes the key
+func pdfSetDictValue(dict, key, value string) string {
+	entries, _ := pdfDictEntries(dict)
+
+	var b strings.Builder
+	b.WriteString("<<")
+	found := false
+	for _, e := range entries {
+		if e[0] == key {
+			found = true
+			e[1] = value
+		}
+		if e[1] != "" {
+			b.WriteString(" /" + e[0] + " " + e[1])
+		}
+	}
+	if !found && value != "" {
+		b.WriteString(" /" + key + " " + value)
+	}
+	b.WriteString(" >>")
+
+	return b.String()
+}
+
+// pdfArray returns the raw values of an array
+func pdfArray(v string) []string {
+	if !strings.HasPrefix(v, "[") {
+		return nil
+	}
+
+	var values []string
+	i := 1
+	for {
+		for i < len(v) && isPDFSpace(v[i]) {
+			i++
+		}
+		if i >= len(v) || v[i] == ']' {
+			return values
+		}
+		end, err := pdfValueEnd(v, i)
+		if err != nil {
+			return values
+		}
+		values = append(values, v[i:end])
+		i = end
+	}
+}
+
+// pdfRef returns the object number of an indirect reference like "12 0 R"
+func pdfRef(v string) (int, bool) {
+	fields := strings.Fields(v)
+	if len(fields) != 3 || fields[2] != "R" {
+		return 0, false
+	}
+	num, err := strconv.Atoi(fields[0])
+	return num, err == nil
+}
+
+// pdfString writes a text string, in UTF-16 when it is not ASCII
+func pdfString(v string) string {
+	ascii := true
+	for _, c := range v {
+		if c > 126 || (c < 32 && c != '\n' && c != '\r' && c != '\t') {
+			ascii = false
+			break
+		}
+	}
+
+	if ascii {
+		r := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`)
+		return "(" + r.Replace(v) + ")"
+	}
+
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, c := range v {
+		if c > 0xFFFF {
+			c -= 0x10000
+			fmt.Fprintf(&b, "%04X%04X", 0xD800+(c>>10), 0xDC00+(c&0x3FF))
+			continue
+		}
+		fmt.Fprintf(&b, "%04X", c)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// pdfName writes a name, escaping the characters that are not regular
+func pdfName(v string) string {
+	var b strings.Builder
+	b.WriteByte('/')
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c < 33 || c > 126 || c == '#' || isPDFDelimiter(c) {
+			fmt.Fprintf(&b, "#%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
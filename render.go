@@ -4,6 +4,8 @@ import (
 	_ "embed"
 	"fmt"
 	"io"
+	"math"
+	"os"
 	"strings"
 
 	"github.com/beevik/etree"
@@ -16,25 +18,55 @@ var RobotoRegular []byte
 //go:embed assets/fonts/Roboto-Medium.ttf
 var RobotoBold []byte
 
+// Options configures how a document is loaded and rendered
+type Options struct {
+	// ImageResolver loads the images referenced by src attributes.
+	// Only data URIs are resolved when it is nil.
+	ImageResolver ImageResolver
+
+	// ImageCache keeps decoded images between renders. Share it between
+	// renders of documents that use the same images, like a logo.
+	ImageCache *ImageCache
+
+	// TemplateLoader loads the XML referenced by include elements
+	TemplateLoader TemplateLoader
+}
+
 // NewRendererFromXML creates a new PDF renderer from XML string
 func NewRendererFromXML(str string) (*Renderer, error) {
-	return newRenderer(str)
+	return newRenderer(str, nil)
+}
+
+// NewRendererFromXMLWithOptions creates a new PDF renderer from XML string
+func NewRendererFromXMLWithOptions(str string, options *Options) (*Renderer, error) {
+	return newRenderer(str, options)
 }
 
 // newRenderer creates a new PDF renderer from XML string
-func newRenderer(str string) (*Renderer, error) {
+func newRenderer(str string, options *Options) (*Renderer, error) {
+	if options == nil {
+		options = &Options{}
+	}
 
 	xmlDoc := etree.NewDocument()
 	if err := xmlDoc.ReadFromString(str); err != nil {
 		return nil, err
 	}
 
+	if err := ExpandComponents(xmlDoc, options.TemplateLoader); err != nil {
+		return nil, err
+	}
+
 	// Parse to PDF document
-	document, err := Parse(xmlDoc)
+	document, err := parse(xmlDoc)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := ResolveImagesWithCache(document, options.ImageResolver, options.ImageCache); err != nil {
+		return nil, err
+	}
+
 	doc := SetLayout(document, nil)
 	if doc == nil {
 		return nil, fmt.Errorf("failed to set layout")
@@ -68,6 +100,9 @@ func NewRenderer(doc *Document, source string) (*Renderer, error) {
 		doc:      doc,
 		rendered: false,
 		source:   source,
+		images:   map[string]gopdf.ImageHolder{},
+		opacity:  1,
+		alpha:    1,
 	}, nil
 }
 
@@ -76,6 +111,25 @@ type Renderer struct {
 	doc      *Document
 	rendered bool
 	source   string
+
+	// images holds the image of each distinct content, so that it is
+	// embedded once and shared by all the pages that draw it
+	images map[string]gopdf.ImageHolder
+
+	// opacity is the product of the opacity of the widgets being
+	// rendered and alpha the transparency set in the PDF
+	opacity float64
+	alpha   float64
+
+	// fields are the form fields added when the document is written
+	fields []*renderedField
+
+	// signature signs the document when it is written
+	signature *SignOptions
+
+	// transforms are the matrices of the transformed widgets, written
+	// in place of their markers when the document is written
+	transforms []*renderedTransform
 }
 
 func (r *Renderer) GetDocument() *Document {
@@ -104,9 +158,20 @@ func (r *Renderer) Render() error {
 func (r *Renderer) renderPage(page *Page) error {
 	r.pdf.AddPage()
 
+	// Each page starts opaque
+	r.pdf.ClearTransparency()
+	r.alpha = 1
+
 	// Render background color
 	r.renderColors(&page.Widget)
 
+	// Render background layer beneath the content
+	if page.Background != nil {
+		if err := r.renderWidget(page.Background); err != nil {
+			return err
+		}
+	}
+
 	// Render header if exists
 	if page.Header != nil {
 		if err := r.renderWidget(page.Header); err != nil {
@@ -121,6 +186,10 @@ func (r *Renderer) renderPage(page *Page) error {
 		}
 	}
 
+	if err := r.renderFootnotes(page); err != nil {
+		return err
+	}
+
 	// Render footer if exists
 	if page.Footer != nil {
 		if err := r.renderWidget(page.Footer); err != nil {
@@ -128,10 +197,84 @@ func (r *Renderer) renderPage(page *Page) error {
 		}
 	}
 
+	// Render overlay and watermark above the content
+	if page.Overlay != nil {
+		if err := r.renderWidget(page.Overlay); err != nil {
+			return err
+		}
+	}
+
+	if page.Watermark != nil {
+		if err := r.renderWatermark(page); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// renderWatermark draws the watermark text or image rotated and
+// translucent in the center of the page.
+func (r *Renderer) renderWatermark(page *Page) error {
+	w := page.Watermark
+
+	cx := page.Calculated.OuterWidth / 2
+	cy := page.Calculated.OuterHeight / 2
+
+	if w.Opacity != nil {
+		opacity := r.opacity
+		r.opacity *= *w.Opacity
+		defer func() { r.opacity = opacity }()
+	}
+
+	// the angle turns clockwise like rotate, the PDF library counterclockwise
+	r.pdf.Rotate(-w.Angle, cx, cy)
+	defer r.pdf.RotateReset()
+
+	if w.Value != "" {
+		fontSize := w.Calculated.FontSize
+		r.setWidgetFont(w, fontSize)
+		r.setTextColor(w.Color)
+
+		width, _ := r.pdf.MeasureTextWidth(w.Value)
+		rect := &gopdf.Rect{W: width, H: fontSize}
+		r.pdf.SetXY(cx-width/2, cy-fontSize/2)
+		return r.pdf.CellWithOption(rect, w.Value, gopdf.CellOption{Align: gopdf.Center | gopdf.Middle})
+	}
+
+	// The image is placed in a copy to keep the laid out watermark unchanged
+	img := *w
+	img.Calculated = &CalculatedInfo{
+		X: cx - w.ImgWidth/2,
+		Y: cy - w.ImgHeight/2,
+	}
+
+	if img.SVG != nil {
+		r.renderSVG(&img)
+		return nil
+	}
+
+	if len(img.Bytes) == 0 {
+		return nil
+	}
+
+	holder, err := r.imageHolder(&img)
+	if err != nil {
+		return err
+	}
+
+	return r.pdf.ImageByHolderWithOptions(holder, gopdf.ImageOptions{
+		X:            img.Calculated.X,
+		Y:            img.Calculated.Y,
+		Rect:         &gopdf.Rect{W: img.ImgWidth, H: img.ImgHeight},
+		Transparency: r.imageTransparency(),
+	})
+}
+
 func (r *Renderer) renderWidget(w *Widget) error {
+	defer r.applyOpacity(w)()
+	defer r.applyTransform(w)()
+
 	switch w.Type {
 	case "div":
 		return r.renderDiv(w)
@@ -139,11 +282,67 @@ func (r *Renderer) renderWidget(w *Widget) error {
 		return r.renderTable(w)
 	case "image", "qr":
 		return r.renderImage(w)
+	case "barcode":
+		return r.renderBarcode(w)
+	case "line", "rect", "circle", "ellipse", "polygon", "path":
+		return r.renderShape(w)
+	case "textfield", "checkbox", "radio", "select", "signatureField":
+		return r.renderField(w)
 	default:
 		return fmt.Errorf("unknown widget type: %s", w.Type)
 	}
 }
 
+// applyOpacity multiplies the opacity of the drawing by the opacity of a
+// widget, for the widget and its children, and returns the function that
+// restores it
+func (r *Renderer) applyOpacity(w *Widget) func() {
+	if w.Opacity == nil {
+		return func() {}
+	}
+
+	opacity := r.opacity
+	r.opacity *= *w.Opacity
+	return func() { r.opacity = opacity }
+}
+
+// applyTransform transforms the drawing of a widget and its children by
+// its rotation and transform, and returns the function that resets them.
+// The PDF library can't write a transformation matrix, so a marker is
+// drawn instead and replaced by the matrix when the PDF is written.
+func (r *Renderer) applyTransform(w *Widget) func() {
+	if w.Rotate == 0 && w.Transform == nil {
+		return func() {}
+	}
+
+	r.transforms = append(r.transforms, &renderedTransform{
+		matrix: widgetMatrix(w),
+		page:   r.pdf.GetNumberOfPages() - 1,
+	})
+
+	r.pdf.SaveGraphicsState()
+	r.pdf.RestoreGraphicsState()
+	r.pdf.SaveGraphicsState()
+	return r.pdf.RestoreGraphicsState
+}
+
+// widgetMatrix returns the rotation of a widget followed by its transform
+// around its center, in the top left coordinates of the page
+func widgetMatrix(w *Widget) svgMatrix {
+	cx := w.Calculated.OuterX + w.Calculated.OuterWidth/2
+	cy := w.Calculated.OuterY + w.Calculated.OuterHeight/2
+
+	angle := w.Rotate * math.Pi / 180
+	m := svgMatrix{math.Cos(angle), math.Sin(angle), -math.Sin(angle), math.Cos(angle), 0, 0}
+	if len(w.Transform) == 6 {
+		var t svgMatrix
+		copy(t[:], w.Transform)
+		m = t.multiply(m)
+	}
+
+	return svgMatrix{1, 0, 0, 1, cx, cy}.multiply(m).multiply(svgMatrix{1, 0, 0, 1, -cx, -cy})
+}
+
 func (r *Renderer) renderDiv(w *Widget) error {
 	r.renderColors(w)
 	r.renderValue(w)
@@ -237,6 +436,11 @@ func (r *Renderer) renderTableCarry(w *Widget, table *Widget, y float64) error {
 }
 
 func (r *Renderer) renderTableRow(w *Widget) error {
+	defer r.applyOpacity(w)()
+	defer r.applyTransform(w)()
+
+	r.renderColors(w)
+
 	// Render table cells
 	for _, child := range w.Children {
 		if err := r.renderTableCell(child); err != nil {
@@ -247,6 +451,9 @@ func (r *Renderer) renderTableRow(w *Widget) error {
 }
 
 func (r *Renderer) renderTableCell(w *Widget) error {
+	defer r.applyOpacity(w)()
+	defer r.applyTransform(w)()
+
 	r.renderColors(w)
 	r.renderValue(w)
 
@@ -276,15 +483,26 @@ func (r *Renderer) renderImage(w *Widget) error {
 		}
 	}
 
-	if len(w.Bytes) > 0 {
-		// Create image holder from bytes
-		imgHolder, err := gopdf.ImageHolderByBytes(w.Bytes)
+	if w.Barcode != nil {
+		if err := r.renderQR(w); err != nil {
+			return err
+		}
+	} else if w.SVG != nil {
+		r.renderSVG(w)
+	} else if len(w.Bytes) > 0 {
+		imgHolder, err := r.imageHolder(w)
 		if err != nil {
-			return fmt.Errorf("failed to create image holder: %v", err)
+			return err
 		}
 
 		// Render the image at the calculated position
-		err = r.pdf.ImageByHolder(imgHolder, w.Calculated.X, w.Calculated.Y, rect)
+		opts := gopdf.ImageOptions{X: w.Calculated.X, Y: w.Calculated.Y, Rect: rect}
+		if w.Fit != "" && rect != nil {
+			opts = r.fitImageOptions(w)
+		}
+		opts.Transparency = r.imageTransparency()
+
+		err = r.pdf.ImageByHolderWithOptions(imgHolder, opts)
 		if err != nil {
 			return fmt.Errorf("failed to render image: %v", err)
 		}
@@ -294,6 +512,377 @@ func (r *Renderer) renderImage(w *Widget) error {
 	return nil
 }
 
+// imageHolder returns the holder of the image bytes, creating it the
+// first time the image is drawn in the document.
+func (r *Renderer) imageHolder(w *Widget) (gopdf.ImageHolder, error) {
+	var key string
+	if w.ImageInfo != nil {
+		key = w.ImageInfo.Key
+	} else {
+		key = imageKey(w.Bytes)
+	}
+
+	if holder, ok := r.images[key]; ok {
+		return holder, nil
+	}
+
+	holder, err := gopdf.ImageHolderByBytes(w.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image holder: %v", err)
+	}
+
+	r.images[key] = holder
+	return holder, nil
+}
+
+// fitImageOptions places a raster image in its box with the fit mode,
+// cropping the parts that overflow the box.
+func (r *Renderer) fitImageOptions(w *Widget) gopdf.ImageOptions {
+	width, height, _ := imageSize(w)
+	posX, posY, _ := parseImagePosition(w.ImagePosition)
+	p := fitImage(w.Fit, posX, posY, w.ImgWidth, w.ImgHeight, width, height)
+
+	opts := gopdf.ImageOptions{
+		X:    w.Calculated.X + p.X,
+		Y:    w.Calculated.Y + p.Y,
+		Rect: &gopdf.Rect{W: p.Width, H: p.Height},
+	}
+
+	if p.Clip {
+		// The crop is relative to the drawn image and starts at X, Y
+		left := math.Max(p.X, 0)
+		top := math.Max(p.Y, 0)
+		opts.X = w.Calculated.X + left
+		opts.Y = w.Calculated.Y + top
+		opts.Crop = &gopdf.CropOptions{
+			X:      left - p.X,
+			Y:      top - p.Y,
+			Width:  math.Min(p.Width, w.ImgWidth-left),
+			Height: math.Min(p.Height, w.ImgHeight-top),
+		}
+	}
+
+	return opts
+}
+
+// renderSVG draws an SVG image as vector graphics scaled to the image box.
+// Without a fit mode the viewBox keeps its aspect ratio centered like
+// SVG's xMidYMid meet.
+func (r *Renderer) renderSVG(w *Widget) {
+	svg := w.SVG
+
+	vbX, vbY, vbWidth, vbHeight := svg.ViewBox[0], svg.ViewBox[1], svg.ViewBox[2], svg.ViewBox[3]
+	if vbWidth <= 0 || vbHeight <= 0 {
+		return
+	}
+
+	fit := w.Fit
+	if fit == "" {
+		fit = FitContain
+	}
+
+	posX, posY, _ := parseImagePosition(w.ImagePosition)
+	p := fitImage(fit, posX, posY, w.ImgWidth, w.ImgHeight, svg.Width, svg.Height)
+
+	scaleX := p.Width / vbWidth
+	scaleY := p.Height / vbHeight
+	scale := math.Sqrt(scaleX * scaleY)
+	x := w.Calculated.X + p.X
+	y := w.Calculated.Y + p.Y
+
+	toPage := func(p Point) Point {
+		return Point{X: x + (p.X-vbX)*scaleX, Y: y + (p.Y-vbY)*scaleY}
+	}
+
+	minX, minY := w.Calculated.X, w.Calculated.Y
+	maxX, maxY := minX+w.ImgWidth, minY+w.ImgHeight
+
+	for _, shape := range svg.Shapes {
+		var stroke *LineStyle
+		if shape.Stroke != nil {
+			scaled := *shape.Stroke
+			scaled.Width *= scale
+			stroke = &scaled
+		}
+
+		var dash []float64
+		for _, d := range shape.Dash {
+			dash = append(dash, d*scale)
+		}
+
+		path := shape.Path.Map(toPage).Flatten(flattenTolerance)
+		if !p.Clip {
+			r.drawPath(path, shape.Fill, stroke, dash)
+			continue
+		}
+
+		if shape.Fill != nil {
+			r.drawPath(path.ClipFill(minX, minY, maxX, maxY), shape.Fill, nil, nil)
+		}
+		if stroke != nil {
+			r.drawPath(path.ClipStroke(minX, minY, maxX, maxY), nil, stroke, dash)
+		}
+	}
+
+	for _, text := range svg.Texts {
+		fontFamily := "roboto"
+		if text.Bold {
+			fontFamily = "robotoBold"
+		}
+
+		fontSize := text.FontSize * scale
+		if err := r.pdf.SetFont(fontFamily, "", fontSize); err != nil {
+			r.pdf.SetFont("roboto", "", fontSize)
+		}
+
+		r.setTextColor(text.Color)
+
+		pos := toPage(Point{text.X, text.Y})
+		width, _ := r.pdf.MeasureTextWidth(text.Text)
+		switch text.Anchor {
+		case "middle":
+			pos.X -= width / 2
+		case "end":
+			pos.X -= width
+		}
+
+		// Text is not clipped, it is hidden if it doesn't fit in the box
+		if p.Clip && (pos.X < minX || pos.X+width > maxX || pos.Y-fontSize < minY || pos.Y > maxY) {
+			continue
+		}
+
+		// The SVG y is the baseline, cells are positioned by their top
+		rect := &gopdf.Rect{W: width, H: fontSize}
+		r.pdf.SetXY(pos.X, pos.Y-fontSize)
+		r.pdf.CellWithOption(rect, text.Text, gopdf.CellOption{Align: gopdf.Left | gopdf.Bottom})
+	}
+}
+
+// renderBarcode draws the bars of a barcode, centered in the widget
+// when the widget is wider.
+func (r *Renderer) renderBarcode(w *Widget) error {
+	r.renderColors(w)
+
+	b := w.Barcode
+	width, _ := b.Size()
+	quiet := b.QuietZone * b.ModuleWidth
+
+	x := w.Calculated.X + quiet
+	if free := w.Calculated.InnerWidth - width; free > 0 {
+		x += free / 2
+	}
+
+	y := w.Calculated.Y
+	if b.Is2D() {
+		y += quiet
+	}
+
+	color := w.Calculated.Color
+	if color == nil {
+		color = &Color{}
+	}
+	r.setFillColor(color)
+
+	moduleHeight := b.ModuleHeight()
+	r.drawModules(x, y, b.Modules, b.ModuleWidth, moduleHeight)
+
+	if b.ShowText && !b.Is2D() {
+		r.setWidgetFont(w, w.Calculated.FontSize)
+		r.setTextColor(color)
+
+		rect := &gopdf.Rect{W: width - quiet*2, H: w.Calculated.LineHeight}
+		r.pdf.SetXY(x, y+float64(len(b.Modules))*moduleHeight)
+		r.pdf.CellWithOption(rect, b.Text, gopdf.CellOption{Align: gopdf.Center | gopdf.Middle})
+	}
+
+	r.renderBorder(w)
+	return nil
+}
+
+// renderQR draws the modules of a QR code scaled to the image box, with
+// the logo in the center area left free of modules and the function
+// patterns of that area drawn over it.
+func (r *Renderer) renderQR(w *Widget) error {
+	b := w.Barcode
+
+	modules := float64(len(b.Modules)) + b.QuietZone*2
+	moduleWidth := w.ImgWidth / modules
+	moduleHeight := w.ImgHeight / modules
+
+	x := w.Calculated.X + b.QuietZone*moduleWidth
+	y := w.Calculated.Y + b.QuietZone*moduleHeight
+
+	// QR codes are black unless they have their own color
+	color := w.Color
+	if color == nil {
+		color = &Color{}
+	}
+	r.setFillColor(color)
+	r.drawModules(x, y, b.Modules, moduleWidth, moduleHeight)
+
+	if w.Logo == nil || len(w.Logo.Bytes) == 0 {
+		return nil
+	}
+
+	// The logo is shared by the clones of the widget in each page
+	logo := *w.Logo
+	start := float64(len(b.Modules)-b.LogoModules) / 2
+	logo.ImgWidth = float64(b.LogoModules) * moduleWidth
+	logo.ImgHeight = float64(b.LogoModules) * moduleHeight
+	logo.Fit = FitContain
+	logo.Calculated = &CalculatedInfo{
+		X: x + start*moduleWidth,
+		Y: y + start*moduleHeight,
+	}
+
+	if err := r.renderImage(&logo); err != nil {
+		return err
+	}
+
+	// The light modules of the patterns are drawn too, in the background
+	// color or white, so that the logo doesn't show through them
+	first := (len(b.Modules) - b.LogoModules) / 2
+	function := qrFunctionModules(len(b.Modules))
+	dark := make([][]bool, b.LogoModules)
+	light := make([][]bool, b.LogoModules)
+	for i := range dark {
+		dark[i] = make([]bool, b.LogoModules)
+		light[i] = make([]bool, b.LogoModules)
+		for j := range dark[i] {
+			if function[first+i][first+j] {
+				dark[i][j] = b.Modules[first+i][first+j]
+				light[i][j] = !b.Modules[first+i][first+j]
+			}
+		}
+	}
+
+	x += float64(first) * moduleWidth
+	y += float64(first) * moduleHeight
+
+	background := w.BackgroundColor
+	if background == nil {
+		background = &Color{R: 255, G: 255, B: 255}
+	}
+	r.setFillColor(background)
+	r.drawModules(x, y, light, moduleWidth, moduleHeight)
+	r.setFillColor(color)
+	r.drawModules(x, y, dark, moduleWidth, moduleHeight)
+
+	return nil
+}
+
+// drawModules draws the dark modules of a barcode as filled rectangles,
+// joining adjacent modules of a row in a single bar.
+func (r *Renderer) drawModules(x, y float64, modules [][]bool, moduleWidth, moduleHeight float64) {
+	for i, row := range modules {
+		top := y + float64(i)*moduleHeight
+		for start := 0; start < len(row); start++ {
+			if !row[start] {
+				continue
+			}
+			end := start
+			for end < len(row) && row[end] {
+				end++
+			}
+			left := x + float64(start)*moduleWidth
+			r.pdf.Rectangle(left, top, left+float64(end-start)*moduleWidth, top+moduleHeight, "F", 0, 0)
+			start = end
+		}
+	}
+}
+
+func (r *Renderer) renderShape(w *Widget) error {
+	r.renderColors(w)
+
+	x := w.Calculated.X
+	y := w.Calculated.Y
+	width := w.Calculated.InnerWidth
+	height := w.Calculated.InnerHeight
+
+	var path *Path
+	switch w.Type {
+	case "line":
+		if w.Line.X == 0 && w.Line.Y == 0 && w.Line.X2 == 0 && w.Line.Y2 == 0 {
+			// A line without coordinates is a horizontal rule
+			path = &Path{Subpaths: []*Subpath{{Points: []Point{{x, y + height/2}, {x + width, y + height/2}}}}}
+		} else {
+			path = &Path{Subpaths: []*Subpath{{Points: []Point{{x + w.Line.X, y + w.Line.Y}, {x + w.Line.X2, y + w.Line.Y2}}}}}
+		}
+	case "rect":
+		path = rectPath(x, y, width, height, w.Radius)
+	case "circle", "ellipse":
+		path = ellipsePath(x+width/2, y+height/2, width/2, height/2)
+	default:
+		path = w.Path.Translate(x, y)
+	}
+
+	stroke := w.Stroke
+	if stroke.Color == nil && w.Calculated.Color != nil {
+		colored := *stroke
+		colored.Color = w.Calculated.Color
+		stroke = &colored
+	}
+
+	// Filled shapes are only stroked when a stroke color is set
+	if w.FillColor != nil && w.StrokeColor == nil {
+		stroke = nil
+	}
+
+	r.drawPath(path.Flatten(flattenTolerance), w.FillColor, stroke, w.StrokeDash)
+	r.renderBorder(w)
+	return nil
+}
+
+// drawPath fills and strokes a path in absolute coordinates
+func (r *Renderer) drawPath(path *Path, fill *Color, stroke *LineStyle, dash []float64) {
+	if stroke != nil && stroke.Style == "none" {
+		stroke = nil
+	}
+
+	if fill != nil {
+		r.setFillColor(fill)
+		for _, sub := range path.Subpaths {
+			r.pdf.Polygon(r.toPoints(sub.Points), "F")
+		}
+	}
+
+	if stroke == nil {
+		return
+	}
+
+	r.setStrokeColor(stroke.Color)
+	r.pdf.SetLineWidth(stroke.Width)
+
+	if len(dash) > 0 {
+		r.pdf.SetCustomLineType(dash, 0)
+	} else {
+		r.pdf.SetLineType(stroke.Style)
+	}
+
+	for _, sub := range path.Subpaths {
+		if sub.Closed {
+			r.pdf.Polygon(r.toPoints(sub.Points), "D")
+			continue
+		}
+		for i := 1; i < len(sub.Points); i++ {
+			a := sub.Points[i-1]
+			b := sub.Points[i]
+			r.pdf.Line(a.X, a.Y, b.X, b.Y)
+		}
+	}
+
+	// Restore the default so that borders are drawn solid
+	r.pdf.SetLineType("solid")
+}
+
+func (r *Renderer) toPoints(points []Point) []gopdf.Point {
+	result := make([]gopdf.Point, len(points))
+	for i, p := range points {
+		result[i] = gopdf.Point{X: p.X, Y: p.Y}
+	}
+	return result
+}
+
 func (r *Renderer) renderValue(w *Widget) {
 	if len(w.ValueLines) == 0 {
 		return
@@ -313,6 +902,23 @@ func (r *Renderer) renderValue(w *Widget) {
 	r.renderWidgetText(w, w.ValueLines, option)
 }
 
+// setWidgetFont sets the font family of a widget, roboto by default and
+// robotoBold for bold text, falling back to roboto if it isn't loaded
+func (r *Renderer) setWidgetFont(w *Widget, size float64) {
+	fontFamily := w.Calculated.FontFamily
+	if fontFamily == "" {
+		fontFamily = "roboto"
+	}
+
+	if w.Calculated.Bold {
+		fontFamily = "robotoBold"
+	}
+
+	if err := r.pdf.SetFont(fontFamily, "", size); err != nil {
+		r.pdf.SetFont("roboto", "", size)
+	}
+}
+
 func (r *Renderer) renderWidgetText(w *Widget, lines []string, option *CellOption) {
 	// Handle text color
 	var textColor *Color
@@ -322,41 +928,43 @@ func (r *Renderer) renderWidgetText(w *Widget, lines []string, option *CellOptio
 		textColor = w.Calculated.Color
 	}
 
-	if textColor != nil {
-		r.pdf.SetTextColor(uint8(textColor.R), uint8(textColor.G), uint8(textColor.B))
-	} else {
-		// Set default black color if no color specified
-		r.pdf.SetTextColor(0, 0, 0)
-	}
+	r.setTextColor(textColor)
 
 	// Set font properties
-	fontFamily := w.Calculated.FontFamily
-	if fontFamily == "" {
-		fontFamily = "roboto"
-	}
-
-	if w.Calculated.Bold {
-		fontFamily = "robotoBold"
-	}
-
-	if err := r.pdf.SetFont(fontFamily, "", w.Calculated.FontSize); err != nil {
-		r.pdf.SetFont("roboto", "", w.Calculated.FontSize)
-	}
+	r.setWidgetFont(w, w.Calculated.FontSize)
 
 	// Get positioning values
 	y := w.Calculated.Y
 	width := w.Calculated.InnerWidth
 	height := w.Calculated.LineHeight
 
+	// Vertical alignment of the whole block of lines in the content box
+	if free := w.Calculated.InnerHeight - float64(len(lines))*height; free > 0 {
+		switch w.VAlign {
+		case VAlignMiddle:
+			y += free / 2
+		case VAlignBottom:
+			y += free
+		}
+	}
+
 	// Render each line
-	for _, line := range lines {
+	for i, line := range lines {
 		r.pdf.SetXY(w.Calculated.X, y)
 
 		// Handle text width overflow
 		textWidth, _ := r.pdf.MeasureTextWidth(line)
 		if width < textWidth {
-			// Truncate text to fit within width
+			// Truncate text to fit within width, leaving room for the ellipsis
+			suffix := ""
+			if w.Overflow == OverflowEllipsis {
+				suffix = ellipsisText
+			}
+
 			bufWidth := 0.0
+			if suffix != "" {
+				bufWidth, _ = r.pdf.MeasureTextWidth(suffix)
+			}
 			var buf []string
 
 			for _, runeChar := range line {
@@ -374,6 +982,7 @@ func (r *Renderer) renderWidgetText(w *Widget, lines []string, option *CellOptio
 				for _, s := range buf {
 					line += s
 				}
+				line += suffix
 			}
 		}
 
@@ -399,14 +1008,38 @@ func (r *Renderer) renderWidgetText(w *Widget, lines []string, option *CellOptio
 
 		r.pdf.CellWithOption(rect, line, goCellOption)
 
+		if w.Leader != "" && i == len(lines)-1 {
+			r.renderLeader(w, line, y, goCellOption.Align&gopdf.Middle)
+		}
+
 		// Move to next line
 		y += height
 	}
 }
 
+// renderLeader repeats the leader of a widget, like the dots of a table
+// of contents, from the end of its last line to the right edge
+func (r *Renderer) renderLeader(w *Widget, line string, y float64, valign int) {
+	textWidth, _ := r.pdf.MeasureTextWidth(line + " ")
+	leaderWidth, _ := r.pdf.MeasureTextWidth(w.Leader)
+	if leaderWidth <= 0 {
+		return
+	}
+
+	count := int((w.Calculated.InnerWidth - textWidth) / leaderWidth)
+	if count <= 0 {
+		return
+	}
+
+	width := float64(count) * leaderWidth
+	rect := &gopdf.Rect{W: width, H: w.Calculated.LineHeight}
+	r.pdf.SetXY(w.Calculated.X+w.Calculated.InnerWidth-width, y)
+	r.pdf.CellWithOption(rect, strings.Repeat(w.Leader, count), gopdf.CellOption{Align: gopdf.Left | valign})
+}
+
 func (r *Renderer) renderColors(w *Widget) {
 	if w.BackgroundColor != nil {
-		r.pdf.SetFillColor(uint8(w.BackgroundColor.R), uint8(w.BackgroundColor.G), uint8(w.BackgroundColor.B))
+		r.setFillColor(w.BackgroundColor)
 
 		borderRadius := float64(0)
 		if w.Border != nil {
@@ -438,9 +1071,7 @@ func (r *Renderer) renderBorder(w *Widget) {
 	// Check if all borders are present and the same
 	if r.hasAllBorders(w.Border) && r.allBordersSame(w.Border) {
 		// Draw full rectangle border
-		if w.Border.Top.Color != nil {
-			r.pdf.SetStrokeColor(uint8(w.Border.Top.Color.R), uint8(w.Border.Top.Color.G), uint8(w.Border.Top.Color.B))
-		}
+		r.setStrokeColor(w.Border.Top.Color)
 
 		if w.Border.Top.Width > 0 {
 			r.pdf.SetLineWidth(w.Border.Top.Width)
@@ -494,13 +1125,74 @@ func (r *Renderer) colorsEqual(c1, c2 *Color) bool {
 	if c1 == nil || c2 == nil {
 		return false
 	}
-	return c1.R == c2.R && c1.G == c2.G && c1.B == c2.B
+	return c1.R == c2.R && c1.G == c2.G && c1.B == c2.B && c1.Alpha() == c2.Alpha()
 }
 
-func (r *Renderer) drawLine(x1, y1, x2, y2 float64, style *LineStyle) {
-	if style.Color != nil {
-		r.pdf.SetStrokeColor(uint8(style.Color.R), uint8(style.Color.G), uint8(style.Color.B))
+// setFillColor sets the color of fills and its transparency
+func (r *Renderer) setFillColor(c *Color) {
+	if cmyk, ok := c.cmyk(); ok {
+		r.pdf.SetFillColorCMYK(cmyk[0], cmyk[1], cmyk[2], cmyk[3])
+	} else {
+		r.pdf.SetFillColor(uint8(c.R), uint8(c.G), uint8(c.B))
+	}
+	r.setAlpha(c)
+}
+
+// setStrokeColor sets the color of lines and its transparency. Without
+// a color the current one is kept.
+func (r *Renderer) setStrokeColor(c *Color) {
+	if cmyk, ok := c.cmyk(); ok {
+		r.pdf.SetStrokeColorCMYK(cmyk[0], cmyk[1], cmyk[2], cmyk[3])
+	} else if c != nil {
+		r.pdf.SetStrokeColor(uint8(c.R), uint8(c.G), uint8(c.B))
+	}
+	r.setAlpha(c)
+}
+
+// setTextColor sets the color of text and its transparency, black by default
+func (r *Renderer) setTextColor(c *Color) {
+	if cmyk, ok := c.cmyk(); ok {
+		r.pdf.SetTextColorCMYK(cmyk[0], cmyk[1], cmyk[2], cmyk[3])
+	} else if c != nil {
+		r.pdf.SetTextColor(uint8(c.R), uint8(c.G), uint8(c.B))
+	} else {
+		r.pdf.SetTextColor(0, 0, 0)
+	}
+	r.setAlpha(c)
+}
+
+// setAlpha sets the transparency of the next drawing operations from the
+// opacity of the widgets being rendered and the alpha of the color.
+func (r *Renderer) setAlpha(c *Color) {
+	alpha := r.opacity
+	if c != nil {
+		alpha *= c.Alpha()
+	}
+
+	if alpha == r.alpha {
+		return
 	}
+	r.alpha = alpha
+
+	if alpha >= 1 {
+		r.pdf.ClearTransparency()
+		return
+	}
+
+	r.pdf.SetTransparency(gopdf.Transparency{Alpha: alpha, BlendModeType: gopdf.NormalBlendMode})
+}
+
+// imageTransparency returns the transparency of images from the opacity
+// of the widgets being rendered, nil if they are opaque.
+func (r *Renderer) imageTransparency() *gopdf.Transparency {
+	if r.opacity >= 1 {
+		return nil
+	}
+	return &gopdf.Transparency{Alpha: r.opacity, BlendModeType: gopdf.NormalBlendMode}
+}
+
+func (r *Renderer) drawLine(x1, y1, x2, y2 float64, style *LineStyle) {
+	r.setStrokeColor(style.Color)
 
 	if style.Width > 0 {
 		r.pdf.SetLineWidth(style.Width)
@@ -515,7 +1207,16 @@ func (r *Renderer) WriteFile(path string) error {
 	if err := r.Render(); err != nil {
 		return err
 	}
-	return r.pdf.WritePdf(path)
+
+	if len(r.fields) == 0 && r.signature == nil && len(r.transforms) == 0 {
+		return r.pdf.WritePdf(path)
+	}
+
+	data, err := r.output()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
 }
 
 func (r *Renderer) Write(w io.Writer) error {
@@ -523,10 +1224,48 @@ func (r *Renderer) Write(w io.Writer) error {
 		return err
 	}
 
-	_, err := r.pdf.WriteTo(w)
+	if len(r.fields) == 0 && r.signature == nil && len(r.transforms) == 0 {
+		_, err := r.pdf.WriteTo(w)
+		return err
+	}
+
+	data, err := r.output()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
 	return err
 }
 
+// output returns the rendered PDF followed by the updates that the PDF
+// library doesn't support, the transforms, the form fields and the signature
+func (r *Renderer) output() ([]byte, error) {
+	data, err := r.pdf.GetBytesPdfReturnErr()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(r.transforms) > 0 {
+		if data, err = r.addTransforms(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(r.fields) > 0 {
+		if data, err = r.addFormFields(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.signature != nil {
+		if data, err = r.sign(data); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
 func (r *Renderer) GetById(id string) *Widget {
 	return r.doGetById(id, &r.doc.Widget)
 }
@@ -567,7 +1306,7 @@ func (r *Renderer) doGetByType(typ string, w *Widget) *Widget {
 
 // WriteFileFromXML renders XML to PDF file
 func WriteFileFromXML(xmlStr string, path string) error {
-	renderer, err := newRenderer(xmlStr)
+	renderer, err := newRenderer(xmlStr, nil)
 	if err != nil {
 		return err
 	}
@@ -577,7 +1316,7 @@ func WriteFileFromXML(xmlStr string, path string) error {
 
 // WriteFromXML renders XML to writer
 func WriteFromXML(xmlStr string, w io.Writer) error {
-	renderer, err := newRenderer(xmlStr)
+	renderer, err := newRenderer(xmlStr, nil)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,300 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPDF returns a one page PDF with a cross reference table
+func testPDF() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] >>",
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return buf.Bytes()
+}
+
+// testCertificate returns a self-signed certificate of a key
+func testCertificate(t *testing.T, key crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// testTimestampToken returns a token with the TSTInfo of a digest
+func testTimestampToken(t *testing.T, digest []byte, nonce *big.Int) []byte {
+	t.Helper()
+
+	info, err := asn1.Marshal(tstInfo{
+		Version: 1,
+		Policy:  asn1.ObjectIdentifier{1, 2, 3},
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			HashedMessage: digest,
+		},
+		SerialNumber: big.NewInt(1),
+		GenTime:      time.Now().UTC().Truncate(time.Second),
+		Nonce:        nonce,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signedData, err := asn1.Marshal(timestampSignedData{
+		Version:          3,
+		DigestAlgorithms: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true},
+		EncapContentInfo: timestampContent{ContentType: oidTSTInfo, Content: info},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := asn1.Marshal(cmsContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestSign(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		key       crypto.Signer
+		algorithm x509.SignatureAlgorithm
+		timestamp bool
+	}{
+		{"rsa", rsaKey, x509.SHA256WithRSA, false},
+		{"ecdsa", ecdsaKey, x509.ECDSAWithSHA256, false},
+		{"timestamp", rsaKey, x509.SHA256WithRSA, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cert := testCertificate(t, test.key)
+			options := &SignOptions{Certificate: cert, PrivateKey: test.key, Reason: "Approval"}
+
+			var token, timestamped []byte
+			if test.timestamp {
+				options.Timestamp = TimestampClientFunc(func(digest []byte) ([]byte, error) {
+					timestamped = digest
+					token = testTimestampToken(t, digest, nil)
+					return token, nil
+				})
+			}
+
+			r := &Renderer{doc: &Document{}}
+			if err := r.Sign(options); err != nil {
+				t.Fatal(err)
+			}
+
+			data := testPDF()
+			out, err := r.sign(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(out, data) {
+				t.Fatal("the signature is not an incremental update")
+			}
+
+			m := regexp.MustCompile(`/ByteRange \[0 (\d+) (\d+) (\d+)\]`).FindSubmatch(out)
+			if m == nil {
+				t.Fatal("missing byte range")
+			}
+			start, _ := strconv.Atoi(string(m[1]))
+			end, _ := strconv.Atoi(string(m[2]))
+			length, _ := strconv.Atoi(string(m[3]))
+			if end+length != len(out) || out[start] != '<' || out[end-1] != '>' {
+				t.Fatalf("invalid byte range: %s", m[0])
+			}
+
+			// the signature is followed by the zeros left of the placeholder
+			contents, err := hex.DecodeString(string(out[start+1 : end-1]))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var contentInfo cmsContentInfo
+			if _, err := asn1.Unmarshal(contents, &contentInfo); err != nil {
+				t.Fatal(err)
+			}
+			var signedData cmsSignedData
+			if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil {
+				t.Fatal(err)
+			}
+			signer := signedData.SignerInfos[0]
+
+			h := sha256.New()
+			h.Write(out[:start])
+			h.Write(out[end:])
+			digest := h.Sum(nil)
+
+			var attributes []cmsAttribute
+			rest := signer.SignedAttrs.Bytes
+			for len(rest) > 0 {
+				var a cmsAttribute
+				if rest, err = asn1.Unmarshal(rest, &a); err != nil {
+					t.Fatal(err)
+				}
+				attributes = append(attributes, a)
+			}
+
+			var messageDigest []byte
+			for _, a := range attributes {
+				if a.Type.Equal(oidAttributeDigest) {
+					if _, err := asn1.Unmarshal(a.Values.Bytes, &messageDigest); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if !bytes.Equal(messageDigest, digest) {
+				t.Fatal("the message digest doesn't match the byte range")
+			}
+
+			attrs, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: signer.SignedAttrs.Bytes})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cert.CheckSignature(test.algorithm, attrs, signer.Signature); err != nil {
+				t.Fatal(err)
+			}
+
+			if !test.timestamp {
+				if len(signer.UnsignedAttrs.Bytes) != 0 {
+					t.Fatal("unexpected unsigned attributes")
+				}
+				return
+			}
+
+			signatureDigest := sha256.Sum256(signer.Signature)
+			if !bytes.Equal(timestamped, signatureDigest[:]) {
+				t.Fatal("the timestamp is not of the signature")
+			}
+			var timestamp cmsAttribute
+			if _, err := asn1.Unmarshal(signer.UnsignedAttrs.Bytes, &timestamp); err != nil {
+				t.Fatal(err)
+			}
+			if !timestamp.Type.Equal(oidAttributeTimestamp) || !bytes.Equal(timestamp.Values.Bytes, token) {
+				t.Fatal("missing timestamp token")
+			}
+		})
+	}
+}
+
+func TestHTTPTimestampClient(t *testing.T) {
+	digest := sha256.Sum256([]byte("signature"))
+
+	tests := []struct {
+		name    string
+		respond func(req timestampRequest) []byte
+		err     string
+	}{
+		{"valid", func(req timestampRequest) []byte {
+			return testTimestampToken(t, req.MessageImprint.HashedMessage, req.Nonce)
+		}, ""},
+		{"digest", func(req timestampRequest) []byte {
+			other := sha256.Sum256([]byte("other"))
+			return testTimestampToken(t, other[:], req.Nonce)
+		}, "doesn't match the digest"},
+		{"nonce", func(req timestampRequest) []byte {
+			return testTimestampToken(t, req.MessageImprint.HashedMessage, new(big.Int).Add(req.Nonce, big.NewInt(1)))
+		}, "doesn't match the nonce"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				var req timestampRequest
+				if _, err := asn1.Unmarshal(body, &req); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				resp, _ := asn1.Marshal(timestampResponse{
+					Status:         pkiStatusInfo{Status: 0},
+					TimeStampToken: asn1.RawValue{FullBytes: test.respond(req)},
+				})
+				w.Header().Set("Content-Type", "application/timestamp-reply")
+				w.Write(resp)
+			}))
+			defer server.Close()
+
+			client := &HTTPTimestampClient{URL: server.URL}
+			token, err := client.Timestamp(digest[:])
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(token) == 0 {
+					t.Fatal("missing timestamp token")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,544 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SignOptions signs the written PDF with a PAdES-B detached signature,
+// a CMS SignedData over the bytes of the file except the signature itself.
+type SignOptions struct {
+	Certificate *x509.Certificate
+	PrivateKey  crypto.Signer
+
+	// Chain are the intermediate certificates embedded with the signature
+	Chain []*x509.Certificate
+
+	Reason      string
+	Location    string
+	ContactInfo string
+
+	// Time is the signing time, now by default
+	Time time.Time
+
+	// WidgetID is the widget that shows the signature. A <signatureField>
+	// is signed, with any other widget a signature field is added on top
+	// of it. The signature is invisible without a widget.
+	WidgetID string
+
+	// Timestamp adds a timestamp of the signature from a TSA when set
+	Timestamp TimestampClient
+}
+
+var (
+	oidData                  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidAttributeContentType  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeDigest       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttributeSigningCert  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidAttributeTimestamp    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+	oidTSTInfo               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidSHA256                = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256       = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	signatureByteRangeFormat = "[0 %010d %010d %010d]"
+)
+
+// Sign makes Write and WriteFile sign the document
+func (r *Renderer) Sign(options *SignOptions) error {
+	if options == nil || options.Certificate == nil || options.PrivateKey == nil {
+		return errors.New("sign: missing certificate or private key")
+	}
+
+	key, ok := options.Certificate.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !key.Equal(options.PrivateKey.Public()) {
+		return errors.New("sign: the private key doesn't match the certificate")
+	}
+
+	if _, err := signatureAlgorithm(options.PrivateKey); err != nil {
+		return err
+	}
+
+	if options.WidgetID != "" {
+		if w, _ := r.findWidget(options.WidgetID); w == nil {
+			return fmt.Errorf("sign: widget not found: %s", options.WidgetID)
+		}
+	}
+
+	r.signature = options
+	return nil
+}
+
+// findWidget returns the widget with an id and the index of its page
+func (r *Renderer) findWidget(id string) (*Widget, int) {
+	for i, page := range r.doc.Pages {
+		var found *Widget
+		for _, w := range append([]*Widget{page.Header, page.Footer}, page.Children...) {
+			if w == nil || found != nil {
+				continue
+			}
+			w.forEach(func(w *Widget) {
+				if found == nil && w.ID == id {
+					found = w
+				}
+			})
+		}
+		if found != nil {
+			return found, i
+		}
+	}
+	return nil, -1
+}
+
+// sign appends the signature to the PDF as an incremental update
+func (r *Renderer) sign(data []byte) ([]byte, error) {
+	options := r.signature
+
+	file, err := readPDFFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := file.pages()
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, errors.New("sign: the document has no pages")
+	}
+
+	root, err := file.root()
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := file.object(root)
+	if err != nil {
+		return nil, err
+	}
+
+	// the AcroForm is in the catalog after adding fields, but other
+	// writers put it in an object of its own
+	acroFormNum, isRef := pdfRef(pdfDictValue(catalog, "AcroForm"))
+	acroForm := pdfDictValue(catalog, "AcroForm")
+	if isRef {
+		if acroForm, err = file.object(acroFormNum); err != nil {
+			return nil, err
+		}
+	}
+	if acroForm == "" {
+		acroForm = "<< /Fields [] >>"
+	}
+	fields := pdfArray(pdfDictValue(acroForm, "Fields"))
+
+	signingTime := options.Time
+	if signingTime.IsZero() {
+		signingTime = time.Now()
+	}
+
+	size := 8192
+	for _, cert := range append([]*x509.Certificate{options.Certificate}, options.Chain...) {
+		size += len(cert.Raw)
+	}
+	if options.Timestamp != nil {
+		size += 8192
+	}
+	placeholder := strings.Repeat("0", size*2)
+
+	u := newPDFUpdate(file)
+
+	dict := fmt.Sprintf("<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /ETSI.CAdES.detached /ByteRange %s /Contents <%s> /M %s",
+		fmt.Sprintf(signatureByteRangeFormat, 0, 0, 0), placeholder, pdfDate(signingTime))
+	if name := options.Certificate.Subject.CommonName; name != "" {
+		dict += " /Name " + pdfString(name)
+	}
+	for _, v := range [][2]string{{"Reason", options.Reason}, {"Location", options.Location}, {"ContactInfo", options.ContactInfo}} {
+		if v[1] != "" {
+			dict += " /" + v[0] + " " + pdfString(v[1])
+		}
+	}
+	sig := u.add(dict + " >>")
+
+	w, index := r.findWidget(options.WidgetID)
+	if w != nil && w.Type == "signatureField" {
+		if err := r.signField(file, u, fields, w, sig, signingTime); err != nil {
+			return nil, err
+		}
+	} else {
+		page := pages[0]
+		rect := "[0 0 0 0]"
+		appearance := ""
+		if w != nil {
+			page = pages[index]
+			rect = widgetRect(w, page)
+			appearance = fmt.Sprintf(" /AP << /N %d 0 R >>", r.signatureAppearance(u, w, signingTime))
+		}
+
+		field := u.reserve()
+		annot := u.add(fmt.Sprintf("<< /Type /Annot /Subtype /Widget /Parent %d 0 R /P %d 0 R /F 132 /Rect %s%s >>",
+			field, page.num, rect, appearance))
+		u.set(field, fmt.Sprintf("<< /FT /Sig /T %s /V %d 0 R /Kids [%d 0 R] >>",
+			pdfString(fmt.Sprintf("Signature%d", len(fields)+1)), sig, annot))
+		fields = append(fields, fmt.Sprintf("%d 0 R", field))
+
+		annots := pdfDictValue(page.dict, "Annots")
+		if ref, ok := pdfRef(annots); ok {
+			if annots, err = file.object(ref); err != nil {
+				return nil, err
+			}
+		}
+		refs := append(pdfArray(annots), fmt.Sprintf("%d 0 R", annot))
+		u.set(page.num, pdfSetDictValue(page.dict, "Annots", "["+strings.Join(refs, " ")+"]"))
+	}
+
+	acroForm = pdfSetDictValue(acroForm, "Fields", "["+strings.Join(fields, " ")+"]")
+	acroForm = pdfSetDictValue(acroForm, "SigFlags", "3")
+	if isRef {
+		u.set(acroFormNum, acroForm)
+	} else {
+		u.set(root, pdfSetDictValue(catalog, "AcroForm", acroForm))
+	}
+
+	out := u.bytes()
+
+	// the signature covers everything but the contents placeholder
+	start := bytes.LastIndex(out, []byte("<"+placeholder+">"))
+	if start == -1 {
+		return nil, errors.New("sign: signature placeholder not found")
+	}
+	end := start + len(placeholder) + 2
+
+	byteRange := []byte(fmt.Sprintf(signatureByteRangeFormat, start, end, len(out)-end))
+	rangeStart := bytes.LastIndex(out[:start], []byte(fmt.Sprintf(signatureByteRangeFormat, 0, 0, 0)))
+	if rangeStart == -1 {
+		return nil, errors.New("sign: byte range placeholder not found")
+	}
+	copy(out[rangeStart:], byteRange)
+
+	h := sha256.New()
+	h.Write(out[:start])
+	h.Write(out[end:])
+
+	signature, err := r.signedData(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	contents := hex.EncodeToString(signature)
+	if len(contents) > len(placeholder) {
+		return nil, errors.New("sign: the signature is larger than its placeholder")
+	}
+	copy(out[start+1:], contents)
+
+	return out, nil
+}
+
+// signField sets the signature as the value of a <signatureField> and
+// draws its appearance
+func (r *Renderer) signField(file *pdfFile, u *pdfUpdate, fields []string, w *Widget, sig int, signingTime time.Time) error {
+	name := pdfString(w.Field.Name)
+
+	for _, ref := range fields {
+		num, ok := pdfRef(ref)
+		if !ok {
+			continue
+		}
+		field, err := file.object(num)
+		if err != nil {
+			return err
+		}
+		if pdfDictValue(field, "T") != name {
+			continue
+		}
+		if pdfDictValue(field, "FT") != "/Sig" {
+			return fmt.Errorf("sign: field %s is not a signature field", w.Field.Name)
+		}
+
+		u.set(num, pdfSetDictValue(field, "V", fmt.Sprintf("%d 0 R", sig)))
+
+		kids := pdfArray(pdfDictValue(field, "Kids"))
+		if len(kids) > 0 {
+			kid, ok := pdfRef(kids[0])
+			if !ok {
+				return fmt.Errorf("sign: invalid widget of field %s", w.Field.Name)
+			}
+			annot, err := file.object(kid)
+			if err != nil {
+				return err
+			}
+			ap := fmt.Sprintf("<< /N %d 0 R >>", r.signatureAppearance(u, w, signingTime))
+			u.set(kid, pdfSetDictValue(annot, "AP", ap))
+		}
+		return nil
+	}
+
+	return fmt.Errorf("sign: field not found: %s", w.Field.Name)
+}
+
+// widgetRect returns the rectangle of a widget in the coordinates of a page
+func widgetRect(w *Widget, page *pdfPage) string {
+	c := w.Calculated
+	return fmt.Sprintf("[%s %s %s %s]",
+		pdfNumber(c.InnerX), pdfNumber(page.height-c.InnerY-c.Height),
+		pdfNumber(c.InnerX+c.Width), pdfNumber(page.height-c.InnerY))
+}
+
+// signatureAppearance adds the visible signature: the signer, the date
+// and the reason, in the font size of the widget or smaller to fit
+func (r *Renderer) signatureAppearance(u *pdfUpdate, w *Widget, signingTime time.Time) int {
+	options := r.signature
+	width := w.Calculated.Width
+	height := w.Calculated.Height
+
+	lines := []string{"Digitally signed by " + options.Certificate.Subject.CommonName}
+	lines = append(lines, "Date: "+signingTime.Format("2006-01-02 15:04:05 -07:00"))
+	if options.Reason != "" {
+		lines = append(lines, "Reason: "+options.Reason)
+	}
+	if options.Location != "" {
+		lines = append(lines, "Location: "+options.Location)
+	}
+
+	size := w.Calculated.FontSize
+	if size == 0 {
+		size = 10
+	}
+	size = math.Min(size, (height-4)/(float64(len(lines))*1.2))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "q %s BT /Helv %s Tf %s TL 2 %s Td", pdfColorOp(w.Calculated.Color),
+		pdfNumber(size), pdfNumber(size*1.2), pdfNumber(height-2-size))
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString(" T*")
+		}
+		fmt.Fprintf(&b, " (%s) Tj", winAnsiText(line))
+	}
+	b.WriteString(" ET Q")
+
+	font := u.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	form := fmt.Sprintf("/Type /XObject /Subtype /Form /BBox [0 0 %s %s] /Resources << /Font << /Helv %d 0 R >> >>",
+		pdfNumber(width), pdfNumber(height), font)
+	return u.addStream(form, []byte(b.String()))
+}
+
+// winAnsiText escapes a text for a literal string in WinAnsi encoding,
+// replacing the characters out of Latin-1
+func winAnsiText(v string) string {
+	var b strings.Builder
+	for _, c := range v {
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case c >= 32 && c < 127:
+			b.WriteRune(c)
+		case c >= 160 && c <= 255:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// pdfDate writes a date like D:20240102150405+01'00'
+func pdfDate(t time.Time) string {
+	_, offset := t.Zone()
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	return fmt.Sprintf("(D:%s%s%02d'%02d')", t.Format("20060102150405"), sign, offset/3600, offset%3600/60)
+}
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo cmsEncapContentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsEncapContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	Sid                cmsIssuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional"`
+}
+
+type cmsIssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// essCertIDv2 identifies the signing certificate, SHA-256 is the default
+// hash algorithm so it is omitted
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// signedData returns the DER encoded CMS SignedData of a SHA-256 digest
+func (r *Renderer) signedData(digest []byte) ([]byte, error) {
+	options := r.signature
+
+	certHash := sha256.Sum256(options.Certificate.Raw)
+	signingCert, err := asn1.Marshal(signingCertificateV2{Certs: []essCertIDv2{{CertHash: certHash[:]}}})
+	if err != nil {
+		return nil, err
+	}
+	contentType, err := asn1.Marshal(oidData)
+	if err != nil {
+		return nil, err
+	}
+	messageDigest, err := asn1.Marshal(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	signedAttrs, err := cmsAttributes([]cmsAttribute{
+		{Type: oidAttributeContentType, Values: cmsSet(contentType)},
+		{Type: oidAttributeDigest, Values: cmsSet(messageDigest)},
+		{Type: oidAttributeSigningCert, Values: cmsSet(signingCert)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the signature is over the DER encoding of the attributes as a SET
+	attrs, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: signedAttrs})
+	if err != nil {
+		return nil, err
+	}
+	attrsDigest := sha256.Sum256(attrs)
+
+	signature, err := options.PrivateKey.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("sign: %w", err)
+	}
+
+	signatureAlg, err := signatureAlgorithm(options.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := cmsSignerInfo{
+		Version: 1,
+		Sid: cmsIssuerAndSerial{
+			Issuer: asn1.RawValue{FullBytes: options.Certificate.RawIssuer},
+			Serial: options.Certificate.SerialNumber,
+		},
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+		SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedAttrs},
+		SignatureAlgorithm: signatureAlg,
+		Signature:          signature,
+	}
+
+	if options.Timestamp != nil {
+		signatureDigest := sha256.Sum256(signature)
+		token, err := options.Timestamp.Timestamp(signatureDigest[:])
+		if err != nil {
+			return nil, fmt.Errorf("sign: timestamp: %w", err)
+		}
+
+		unsignedAttrs, err := cmsAttributes([]cmsAttribute{
+			{Type: oidAttributeTimestamp, Values: cmsSet(token)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		signer.UnsignedAttrs = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: unsignedAttrs}
+	}
+
+	var certs []byte
+	for _, cert := range append([]*x509.Certificate{options.Certificate}, options.Chain...) {
+		certs = append(certs, cert.Raw...)
+	}
+
+	signedData, err := asn1.Marshal(cmsSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: cmsEncapContentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos:      []cmsSignerInfo{signer},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(cmsContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+}
+
+// cmsSet returns a SET with one DER encoded value
+func cmsSet(value []byte) asn1.RawValue {
+	return asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: value}
+}
+
+// cmsAttributes returns the content of a SET OF attributes, sorted by
+// their encoding as DER requires
+func cmsAttributes(attributes []cmsAttribute) ([]byte, error) {
+	var encoded [][]byte
+	for _, a := range attributes {
+		b, err := asn1.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, b)
+	}
+
+	sort.Slice(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	})
+
+	return bytes.Join(encoded, nil), nil
+}
+
+// signatureAlgorithm returns the algorithm of the signatures of a key
+func signatureAlgorithm(key crypto.Signer) (pkix.AlgorithmIdentifier, error) {
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}, nil
+	case *ecdsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+	}
+	return pkix.AlgorithmIdentifier{}, errors.New("sign: only RSA and ECDSA keys are supported")
+}
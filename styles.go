@@ -0,0 +1,296 @@
+package pdf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/beevik/etree"
+)
+
+// styleSheet holds the rules of the <style> blocks of a document
+type styleSheet struct {
+	rules []*styleRule
+}
+
+// styleRule sets declarations on the elements matching its selector.
+// Order is the position of the rule in the style sheet, later rules win
+// over earlier ones with the same specificity.
+type styleRule struct {
+	selector     []styleSelector
+	declarations [][2]string
+	specificity  int
+	order        int
+}
+
+// styleSelector is a compound selector like cell.header or #total,
+// a rule selector is a list of them separated by descendant combinators
+type styleSelector struct {
+	tag     string
+	id      string
+	classes []string
+}
+
+// parseStyleSheet parses CSS like rules:
+//
+//	.amount { align: right; bold: true }
+//	cell.header, #total { backgroundColor: #eee }
+func parseStyleSheet(css string) (*styleSheet, error) {
+	sheet := &styleSheet{}
+	css = removeStyleComments(css)
+
+	for {
+		start := strings.Index(css, "{")
+		if start == -1 {
+			if strings.TrimSpace(css) != "" {
+				return nil, fmt.Errorf("style: invalid rule: %s", strings.TrimSpace(css))
+			}
+			return sheet, nil
+		}
+
+		end := strings.Index(css, "}")
+		if end < start {
+			return nil, fmt.Errorf("style: missing }: %s", strings.TrimSpace(css))
+		}
+
+		declarations, err := parseStyleDeclarations(css[start+1 : end])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range strings.Split(css[:start], ",") {
+			selector, err := parseStyleSelector(v)
+			if err != nil {
+				return nil, err
+			}
+
+			rule := &styleRule{
+				selector:     selector,
+				declarations: declarations,
+				order:        len(sheet.rules),
+			}
+			for _, s := range selector {
+				rule.specificity += s.specificity()
+			}
+			sheet.rules = append(sheet.rules, rule)
+		}
+
+		css = css[end+1:]
+	}
+}
+
+func removeStyleComments(css string) string {
+	for {
+		start := strings.Index(css, "/*")
+		if start == -1 {
+			return css
+		}
+		end := strings.Index(css[start+2:], "*/")
+		if end == -1 {
+			return css[:start]
+		}
+		css = css[:start] + " " + css[start+2+end+2:]
+	}
+}
+
+// parseStyleSelector parses a selector made of compound selectors
+// separated by spaces, like "table cell.amount"
+func parseStyleSelector(v string) ([]styleSelector, error) {
+	fields := strings.Fields(v)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("style: empty selector")
+	}
+
+	var result []styleSelector
+	for _, field := range fields {
+		s, err := parseCompoundSelector(field)
+		if err != nil {
+			return nil, fmt.Errorf("style: invalid selector: %s", strings.TrimSpace(v))
+		}
+		result = append(result, s)
+	}
+
+	return result, nil
+}
+
+func parseCompoundSelector(v string) (styleSelector, error) {
+	var s styleSelector
+
+	// Split before each . and #, the first part is the tag
+	var parts []string
+	last := 0
+	for i, c := range v {
+		if (c == '.' || c == '#') && i > 0 {
+			parts = append(parts, v[last:i])
+			last = i
+		}
+	}
+	parts = append(parts, v[last:])
+
+	for i, part := range parts {
+		switch {
+		case part[0] == '.':
+			if !isStyleName(part[1:]) {
+				return s, fmt.Errorf("invalid class: %s", part)
+			}
+			s.classes = append(s.classes, part[1:])
+		case part[0] == '#':
+			if !isStyleName(part[1:]) || s.id != "" {
+				return s, fmt.Errorf("invalid id: %s", part)
+			}
+			s.id = part[1:]
+		case i == 0 && (part == "*" || isStyleName(part)):
+			if part != "*" {
+				s.tag = part
+			}
+		default:
+			return s, fmt.Errorf("invalid tag: %s", part)
+		}
+	}
+
+	return s, nil
+}
+
+func isStyleName(v string) bool {
+	if v == "" {
+		return false
+	}
+	for _, c := range v {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// specificity counts ids, classes and tags like CSS
+func (s styleSelector) specificity() int {
+	n := len(s.classes) * 100
+	if s.id != "" {
+		n += 10000
+	}
+	if s.tag != "" {
+		n++
+	}
+	return n
+}
+
+// parseStyleDeclarations parses "name: value" pairs separated by
+// semicolons. Names are the attribute names, CSS kebab case names like
+// background-color are accepted too.
+func parseStyleDeclarations(v string) ([][2]string, error) {
+	var result [][2]string
+
+	for _, declaration := range strings.Split(v, ";") {
+		if strings.TrimSpace(declaration) == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(declaration, ":")
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+		if !ok || !isStyleName(name) || value == "" {
+			return nil, fmt.Errorf("style: invalid declaration: %s", strings.TrimSpace(declaration))
+		}
+
+		result = append(result, [2]string{styleAttrName(name), value})
+	}
+
+	return result, nil
+}
+
+// styleAttrName converts a kebab case name to the camel case attribute name
+func styleAttrName(name string) string {
+	parts := strings.Split(name, "-")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// apply sets the declarations of the matching rules as attributes of the
+// element and its descendants. Attributes written on the element win over
+// the rules, and rules win over the values inherited from the parents.
+func (s *styleSheet) apply(el *etree.Element) {
+	var rules []*styleRule
+	for _, rule := range s.rules {
+		if rule.matches(el) {
+			rules = append(rules, rule)
+		}
+	}
+
+	if len(rules) > 0 {
+		sort.SliceStable(rules, func(i, j int) bool {
+			if rules[i].specificity != rules[j].specificity {
+				return rules[i].specificity < rules[j].specificity
+			}
+			return rules[i].order < rules[j].order
+		})
+
+		inline := map[string]bool{}
+		for _, attr := range el.Attr {
+			inline[attr.Key] = true
+		}
+
+		for _, rule := range rules {
+			for _, d := range rule.declarations {
+				if !inline[d[0]] {
+					el.CreateAttr(d[0], d[1])
+				}
+			}
+		}
+	}
+
+	for _, child := range el.ChildElements() {
+		s.apply(child)
+	}
+}
+
+// matches reports if the last compound selector matches the element and
+// the previous ones match its ancestors in order
+func (r *styleRule) matches(el *etree.Element) bool {
+	last := len(r.selector) - 1
+	if !r.selector[last].matches(el) {
+		return false
+	}
+
+	i := last - 1
+	for parent := el.Parent(); parent != nil && i >= 0; parent = parent.Parent() {
+		if r.selector[i].matches(parent) {
+			i--
+		}
+	}
+
+	return i < 0
+}
+
+func (s styleSelector) matches(el *etree.Element) bool {
+	if s.tag != "" && s.tag != el.Tag {
+		return false
+	}
+
+	if s.id != "" && s.id != el.SelectAttrValue("id", "") {
+		return false
+	}
+
+	if len(s.classes) > 0 {
+		classes := strings.Fields(el.SelectAttrValue("class", ""))
+		for _, class := range s.classes {
+			found := false
+			for _, c := range classes {
+				if c == class {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,506 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// SVGImage is an SVG document converted to flattened vector shapes that
+// are drawn natively in the PDF. Coordinates are in the user units of the
+// root viewBox.
+type SVGImage struct {
+	Width   float64     `json:"width"`
+	Height  float64     `json:"height"`
+	ViewBox [4]float64  `json:"viewBox"`
+	Shapes  []*SVGShape `json:"shapes,omitempty"`
+	Texts   []*SVGText  `json:"texts,omitempty"`
+}
+
+// SVGShape is a filled and/or stroked path
+type SVGShape struct {
+	Path   *Path      `json:"path"`
+	Fill   *Color     `json:"fill,omitempty"`
+	Stroke *LineStyle `json:"stroke,omitempty"`
+	Dash   []float64  `json:"dash,omitempty"`
+}
+
+// SVGText is a text run with its baseline origin
+type SVGText struct {
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Text     string  `json:"text"`
+	FontSize float64 `json:"fontSize"`
+	Bold     bool    `json:"bold,omitempty"`
+	Anchor   string  `json:"anchor,omitempty"`
+	Color    *Color  `json:"color,omitempty"`
+}
+
+// svgMatrix is an affine transform [a b c d e f]
+type svgMatrix [6]float64
+
+var svgIdentity = svgMatrix{1, 0, 0, 1, 0, 0}
+
+func (m svgMatrix) multiply(n svgMatrix) svgMatrix {
+	return svgMatrix{
+		m[0]*n[0] + m[2]*n[1],
+		m[1]*n[0] + m[3]*n[1],
+		m[0]*n[2] + m[2]*n[3],
+		m[1]*n[2] + m[3]*n[3],
+		m[0]*n[4] + m[2]*n[5] + m[4],
+		m[1]*n[4] + m[3]*n[5] + m[5],
+	}
+}
+
+func (m svgMatrix) apply(p Point) Point {
+	return Point{
+		X: m[0]*p.X + m[2]*p.Y + m[4],
+		Y: m[1]*p.X + m[3]*p.Y + m[5],
+	}
+}
+
+// scale returns the average scale factor, used for stroke widths and font sizes
+func (m svgMatrix) scale() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+// svgStyle holds the inherited presentation attributes
+type svgStyle struct {
+	fill        *Color
+	stroke      *Color
+	strokeWidth float64
+	dash        []float64
+	fontSize    float64
+	bold        bool
+	anchor      string
+	color       *Color
+	gradients   map[string]*Color
+}
+
+// isSVG reports if the bytes look like an SVG document
+func isSVG(data []byte) bool {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	return bytes.Contains(head, []byte("<svg"))
+}
+
+// parseSVG converts an SVG document into vector shapes
+func parseSVG(data []byte) (*SVGImage, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, fmt.Errorf("svg: %w", err)
+	}
+
+	root := doc.Root()
+	if root == nil || root.Tag != "svg" {
+		return nil, fmt.Errorf("svg: missing svg root element")
+	}
+
+	img := &SVGImage{}
+
+	width := parseSVGLength(getAttrValue(root, "width", ""))
+	height := parseSVGLength(getAttrValue(root, "height", ""))
+
+	if v := getAttrValue(root, "viewBox", ""); v != "" {
+		numbers, err := parseNumbers(v)
+		if err != nil || len(numbers) != 4 {
+			return nil, fmt.Errorf("svg: invalid viewBox: %s", v)
+		}
+		copy(img.ViewBox[:], numbers)
+	} else {
+		// user units are pixels
+		img.ViewBox = [4]float64{0, 0, width / svgPointsPerPixel, height / svgPointsPerPixel}
+	}
+
+	vbWidth := img.ViewBox[2]
+	vbHeight := img.ViewBox[3]
+
+	switch {
+	case width == 0 && height == 0:
+		width = vbWidth * svgPointsPerPixel
+		height = vbHeight * svgPointsPerPixel
+	case width == 0 && vbHeight > 0:
+		width = height * vbWidth / vbHeight
+	case height == 0 && vbWidth > 0:
+		height = width * vbHeight / vbWidth
+	}
+
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("svg: unknown size, set width/height or viewBox")
+	}
+
+	img.Width = width
+	img.Height = height
+
+	style := svgStyle{
+		fill:        &Color{},
+		strokeWidth: 1,
+		fontSize:    16,
+		gradients:   svgGradients(root),
+	}
+
+	if err := img.parseChildren(root, svgIdentity, style); err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// svgPointsPerPixel converts CSS pixels (96 dpi) to points (72 dpi)
+const svgPointsPerPixel = 0.75
+
+// parseSVGLength parses a length with an optional unit and returns points
+func parseSVGLength(v string) float64 {
+	v = strings.TrimSpace(v)
+	if v == "" || strings.HasSuffix(v, "%") {
+		return 0
+	}
+
+	units := map[string]float64{
+		"pt": 1,
+		"px": svgPointsPerPixel,
+		"in": 72,
+		"cm": 72 / 2.54,
+		"mm": 72 / 25.4,
+		"pc": 12,
+	}
+
+	for unit, factor := range units {
+		if strings.HasSuffix(v, unit) {
+			return parseFloat(strings.TrimSuffix(v, unit)) * factor
+		}
+	}
+
+	return parseFloat(v) * svgPointsPerPixel
+}
+
+func (img *SVGImage) parseChildren(el *etree.Element, m svgMatrix, style svgStyle) error {
+	for _, child := range el.ChildElements() {
+		if err := img.parseElement(child, m, style); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (img *SVGImage) parseElement(el *etree.Element, parent svgMatrix, parentStyle svgStyle) error {
+	m := parent
+	if v := getAttrValue(el, "transform", ""); v != "" {
+		t, err := parseSVGTransform(v)
+		if err != nil {
+			return fmt.Errorf("svg: %w", err)
+		}
+		m = m.multiply(t)
+	}
+
+	style := parseSVGStyle(el, parentStyle)
+
+	var path *Path
+
+	switch el.Tag {
+	case "g", "a":
+		return img.parseChildren(el, m, style)
+
+	case "svg":
+		// nested viewports are only translated
+		x := parseFloatAttr(el, "x", 0)
+		y := parseFloatAttr(el, "y", 0)
+		return img.parseChildren(el, m.multiply(svgMatrix{1, 0, 0, 1, x, y}), style)
+
+	case "path":
+		p, err := parsePathData(getAttrValue(el, "d", ""))
+		if err != nil {
+			return fmt.Errorf("svg: %w", err)
+		}
+		path = p
+
+	case "rect":
+		x := parseFloatAttr(el, "x", 0)
+		y := parseFloatAttr(el, "y", 0)
+		width := parseFloatAttr(el, "width", 0)
+		height := parseFloatAttr(el, "height", 0)
+		rx := parseFloatAttr(el, "rx", parseFloatAttr(el, "ry", 0))
+		path = rectPath(x, y, width, height, rx)
+
+	case "circle":
+		r := parseFloatAttr(el, "r", 0)
+		path = ellipsePath(parseFloatAttr(el, "cx", 0), parseFloatAttr(el, "cy", 0), r, r)
+
+	case "ellipse":
+		path = ellipsePath(parseFloatAttr(el, "cx", 0), parseFloatAttr(el, "cy", 0),
+			parseFloatAttr(el, "rx", 0), parseFloatAttr(el, "ry", 0))
+
+	case "line":
+		path = &Path{Subpaths: []*Subpath{{Points: []Point{
+			{parseFloatAttr(el, "x1", 0), parseFloatAttr(el, "y1", 0)},
+			{parseFloatAttr(el, "x2", 0), parseFloatAttr(el, "y2", 0)},
+		}}}}
+
+	case "polyline", "polygon":
+		points, err := parsePoints(getAttrValue(el, "points", ""))
+		if err != nil {
+			return fmt.Errorf("svg: %s: %w", el.Tag, err)
+		}
+		path = &Path{Subpaths: []*Subpath{{Points: points, Closed: el.Tag == "polygon"}}}
+
+	case "text":
+		img.parseText(el, m, style)
+		return nil
+
+	default:
+		// defs, style, metadata, title... are not rendered
+		return nil
+	}
+
+	if style.fill == nil && style.stroke == nil {
+		return nil
+	}
+
+	shape := &SVGShape{
+		Path: path.Map(m.apply),
+		Fill: style.fill,
+	}
+
+	if style.stroke != nil && style.strokeWidth > 0 {
+		shape.Stroke = &LineStyle{
+			Width: style.strokeWidth * m.scale(),
+			Color: style.stroke,
+			Style: "solid",
+		}
+		for _, d := range style.dash {
+			shape.Dash = append(shape.Dash, d*m.scale())
+		}
+	}
+
+	img.Shapes = append(img.Shapes, shape)
+	return nil
+}
+
+func (img *SVGImage) parseText(el *etree.Element, m svgMatrix, style svgStyle) {
+	text := strings.Fields(svgTextContent(el))
+	if len(text) == 0 {
+		return
+	}
+
+	p := m.apply(Point{parseFloatAttr(el, "x", 0), parseFloatAttr(el, "y", 0)})
+
+	color := style.fill
+	if color == nil {
+		color = style.stroke
+	}
+
+	img.Texts = append(img.Texts, &SVGText{
+		X:        p.X,
+		Y:        p.Y,
+		Text:     strings.Join(text, " "),
+		FontSize: style.fontSize * m.scale(),
+		Bold:     style.bold,
+		Anchor:   style.anchor,
+		Color:    color,
+	})
+}
+
+// svgTextContent returns the text of an element including its tspans
+func svgTextContent(el *etree.Element) string {
+	var b strings.Builder
+	for _, child := range el.Child {
+		switch c := child.(type) {
+		case *etree.CharData:
+			b.WriteString(c.Data)
+		case *etree.Element:
+			b.WriteString(" ")
+			b.WriteString(svgTextContent(c))
+		}
+	}
+	return b.String()
+}
+
+// parseSVGStyle reads the presentation attributes and the style attribute
+// of an element, which take precedence, over the inherited style.
+func parseSVGStyle(el *etree.Element, parent svgStyle) svgStyle {
+	style := parent
+	props := svgProperties(el)
+
+	if v, ok := props["color"]; ok {
+		if c, err := parseColor(v); err == nil {
+			style.color = c
+		}
+	}
+	if v, ok := props["fill"]; ok {
+		style.fill = svgPaint(v, style.color, style.gradients)
+	}
+	if v, ok := props["stroke"]; ok {
+		style.stroke = svgPaint(v, style.color, style.gradients)
+	}
+	if v, ok := props["stroke-width"]; ok {
+		style.strokeWidth = parseFloat(strings.TrimSuffix(v, "px"))
+	}
+	if v, ok := props["stroke-dasharray"]; ok {
+		style.dash, _ = parseNumbers(strings.ReplaceAll(v, "none", ""))
+	}
+	if v, ok := props["font-size"]; ok {
+		style.fontSize = parseFloat(strings.TrimSuffix(v, "px"))
+	}
+	if v, ok := props["font-weight"]; ok {
+		style.bold = v == "bold" || v == "bolder" || parseFloat(v) >= 600
+	}
+	if v, ok := props["text-anchor"]; ok {
+		style.anchor = v
+	}
+
+	return style
+}
+
+// svgProperties returns the presentation attributes of an element merged
+// with its style attribute, which takes precedence
+func svgProperties(el *etree.Element) map[string]string {
+	props := map[string]string{}
+	for _, attr := range el.Attr {
+		props[attr.Key] = attr.Value
+	}
+	for _, decl := range strings.Split(getAttrValue(el, "style", ""), ";") {
+		if i := strings.Index(decl, ":"); i != -1 {
+			props[strings.TrimSpace(decl[:i])] = strings.TrimSpace(decl[i+1:])
+		}
+	}
+	return props
+}
+
+// svgPaint parses a fill or stroke value, nil meaning no paint. A gradient
+// paints with the color of its first stop; any other paint server, or an
+// unknown reference, uses the fallback color after the url, or no paint.
+func svgPaint(v string, current *Color, gradients map[string]*Color) *Color {
+	v = strings.TrimSpace(v)
+	switch v {
+	case "none", "transparent":
+		return nil
+	case "currentColor":
+		if current != nil {
+			return current
+		}
+		return &Color{}
+	}
+
+	if strings.HasPrefix(v, "url(") {
+		end := strings.Index(v, ")")
+		if end == -1 {
+			return nil
+		}
+		id := strings.Trim(strings.TrimSpace(v[4:end]), `"'`)
+		if c, ok := gradients[strings.TrimPrefix(id, "#")]; ok {
+			return c
+		}
+		if fallback := strings.TrimSpace(v[end+1:]); fallback != "" {
+			return svgPaint(fallback, current, gradients)
+		}
+		return nil
+	}
+
+	if c, err := parseColor(v); err == nil {
+		return c
+	}
+
+	return &Color{}
+}
+
+// svgGradients returns the color of the first stop of the linear and
+// radial gradients of a document by id, following the href of gradients
+// that inherit their stops
+func svgGradients(root *etree.Element) map[string]*Color {
+	elements := map[string]*etree.Element{}
+	for _, tag := range []string{"linearGradient", "radialGradient"} {
+		for _, el := range root.FindElements("//" + tag) {
+			if id := getAttrValue(el, "id", ""); id != "" {
+				elements[id] = el
+			}
+		}
+	}
+
+	gradients := map[string]*Color{}
+	for id, el := range elements {
+		for seen := map[*etree.Element]bool{}; el != nil && !seen[el]; {
+			seen[el] = true
+			if stop := el.SelectElement("stop"); stop != nil {
+				gradients[id] = svgStopColor(stop)
+				break
+			}
+			href := getAttrValue(el, "xlink:href", getAttrValue(el, "href", ""))
+			el = elements[strings.TrimPrefix(href, "#")]
+		}
+	}
+
+	return gradients
+}
+
+// svgStopColor returns the color of a gradient stop, black by default
+func svgStopColor(stop *etree.Element) *Color {
+	if c, err := parseColor(svgProperties(stop)["stop-color"]); err == nil {
+		return c
+	}
+	return &Color{}
+}
+
+// parseSVGTransform parses a transform list like "translate(10,20) scale(2)"
+func parseSVGTransform(v string) (svgMatrix, error) {
+	m := svgIdentity
+
+	for {
+		v = strings.TrimLeft(v, " \t\n\r,")
+		if v == "" {
+			return m, nil
+		}
+
+		open := strings.Index(v, "(")
+		end := strings.Index(v, ")")
+		if open == -1 || end < open {
+			return m, fmt.Errorf("invalid transform: %s", v)
+		}
+
+		name := strings.TrimSpace(v[:open])
+		args, err := parseNumbers(v[open+1 : end])
+		if err != nil {
+			return m, fmt.Errorf("invalid transform: %w", err)
+		}
+		v = v[end+1:]
+
+		arg := func(i int, def float64) float64 {
+			if i < len(args) {
+				return args[i]
+			}
+			return def
+		}
+
+		var t svgMatrix
+		switch name {
+		case "matrix":
+			if len(args) != 6 {
+				return m, fmt.Errorf("invalid transform: matrix expects 6 values")
+			}
+			copy(t[:], args)
+		case "translate":
+			t = svgMatrix{1, 0, 0, 1, arg(0, 0), arg(1, 0)}
+		case "scale":
+			sx := arg(0, 1)
+			t = svgMatrix{sx, 0, 0, arg(1, sx), 0, 0}
+		case "rotate":
+			a := arg(0, 0) * math.Pi / 180
+			cx, cy := arg(1, 0), arg(2, 0)
+			t = svgMatrix{1, 0, 0, 1, cx, cy}.
+				multiply(svgMatrix{math.Cos(a), math.Sin(a), -math.Sin(a), math.Cos(a), 0, 0}).
+				multiply(svgMatrix{1, 0, 0, 1, -cx, -cy})
+		case "skewX":
+			t = svgMatrix{1, 0, math.Tan(arg(0, 0) * math.Pi / 180), 1, 0, 0}
+		case "skewY":
+			t = svgMatrix{1, math.Tan(arg(0, 0) * math.Pi / 180), 0, 1, 0, 0}
+		default:
+			return m, fmt.Errorf("unknown transform: %s", name)
+		}
+
+		m = m.multiply(t)
+	}
+}
@@ -0,0 +1,195 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// TimestampClient returns the RFC 3161 timestamp token, a DER encoded
+// CMS ContentInfo, of a SHA-256 digest. Tests can stub it with a local
+// function instead of a TSA.
+type TimestampClient interface {
+	Timestamp(digest []byte) ([]byte, error)
+}
+
+// TimestampClientFunc adapts a function to the TimestampClient interface
+type TimestampClientFunc func(digest []byte) ([]byte, error)
+
+func (f TimestampClientFunc) Timestamp(digest []byte) ([]byte, error) {
+	return f(digest)
+}
+
+// HTTPTimestampClient requests timestamps from a TSA over HTTP
+type HTTPTimestampClient struct {
+	URL string
+
+	// Client sends the requests, http.DefaultClient when nil
+	Client *http.Client
+
+	// Username and Password are sent with basic authentication when set
+	Username string
+	Password string
+}
+
+type timestampRequest struct {
+	Version        int
+	MessageImprint messageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional"`
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timestampResponse struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.RawValue `asn1:"optional"`
+}
+
+// timestampSignedData is the start of the SignedData of a token, the
+// elements after the content are not needed to read the TSTInfo
+type timestampSignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo timestampContent
+}
+
+type timestampContent struct {
+	ContentType asn1.ObjectIdentifier
+	Content     []byte `asn1:"explicit,tag:0"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time   `asn1:"generalized"`
+	Accuracy       tstAccuracy `asn1:"optional"`
+	Ordering       bool        `asn1:"optional"`
+	Nonce          *big.Int    `asn1:"optional"`
+}
+
+type tstAccuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+func (c *HTTPTimestampClient) Timestamp(digest []byte) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := asn1.Marshal(timestampRequest{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/timestamp-query")
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tsa: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result timestampResponse
+	if _, err := asn1.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("tsa: invalid response: %w", err)
+	}
+
+	// 0 is granted and 1 granted with modifications
+	if result.Status.Status > 1 {
+		return nil, fmt.Errorf("tsa: request rejected with status %d", result.Status.Status)
+	}
+	if len(result.TimeStampToken.FullBytes) == 0 {
+		return nil, errors.New("tsa: missing timestamp token")
+	}
+
+	if err := checkTimestampToken(result.TimeStampToken.FullBytes, digest, nonce); err != nil {
+		return nil, err
+	}
+
+	return result.TimeStampToken.FullBytes, nil
+}
+
+// checkTimestampToken checks that a token timestamps the digest of the
+// request and answers it, with the same nonce
+func checkTimestampToken(token []byte, digest []byte, nonce *big.Int) error {
+	var contentInfo cmsContentInfo
+	if _, err := asn1.Unmarshal(token, &contentInfo); err != nil {
+		return fmt.Errorf("tsa: invalid timestamp token: %w", err)
+	}
+	if !contentInfo.ContentType.Equal(oidSignedData) {
+		return errors.New("tsa: invalid timestamp token: not a signed data")
+	}
+
+	var signedData timestampSignedData
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil {
+		return fmt.Errorf("tsa: invalid timestamp token: %w", err)
+	}
+	if !signedData.EncapContentInfo.ContentType.Equal(oidTSTInfo) {
+		return errors.New("tsa: invalid timestamp token: not a TSTInfo")
+	}
+
+	var info tstInfo
+	if _, err := asn1.Unmarshal(signedData.EncapContentInfo.Content, &info); err != nil {
+		return fmt.Errorf("tsa: invalid timestamp token: %w", err)
+	}
+
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) || !bytes.Equal(info.MessageImprint.HashedMessage, digest) {
+		return errors.New("tsa: the timestamp doesn't match the digest")
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return errors.New("tsa: the timestamp doesn't match the nonce")
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package pdf
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// TOC is set on <toc> widgets, filled with one entry per heading of the
+// document when parsed. The entries are laid out with the document and
+// their page numbers set once the pages are split. A page number wider
+// than NumberWidth widens the column and the document is laid out again.
+type TOC struct {
+	Levels      int     `json:"levels"`      // deepest heading level listed
+	Indent      float64 `json:"indent"`      // indentation per level
+	Leader      string  `json:"leader"`      // repeated between the text and the number
+	NumberWidth float64 `json:"numberWidth"` // width of the page number column
+}
+
+func parseTOC(el *etree.Element) (*Widget, error) {
+	w, err := parseWidget(el)
+	if err != nil {
+		return nil, err
+	}
+
+	toc := &TOC{
+		Indent:      parseFloatAttr(el, "indent", 15),
+		Leader:      getAttrValue(el, "leader", "."),
+		NumberWidth: parseFloatAttr(el, "numberWidth", 40),
+	}
+
+	v := getAttrValue(el, "levels", "3")
+	levels, err := strconv.Atoi(v)
+	if err != nil || levels < 1 {
+		return nil, fmt.Errorf("toc: invalid levels value: %s", v)
+	}
+	toc.Levels = levels
+
+	w.TOC = toc
+	return w, nil
+}
+
+// parseHeading parses the heading attribute, the level of the widget in
+// the table of contents
+func parseHeading(el *etree.Element, w *Widget) error {
+	v := getAttrValue(el, "heading", "")
+	if v == "" {
+		return nil
+	}
+
+	level, err := strconv.Atoi(v)
+	if err != nil || level < 1 {
+		return fmt.Errorf("%s: invalid heading value: %s", el.Tag, v)
+	}
+
+	w.Heading = level
+	return nil
+}
+
+// expandTOCs fills the <toc> widgets of the document with their entries
+func expandTOCs(doc *Document) {
+	var headings []*Widget
+	for _, page := range doc.Pages {
+		for _, w := range page.Children {
+			w.forEach(func(w *Widget) {
+				if w.Heading > 0 {
+					headings = append(headings, w)
+				}
+			})
+		}
+	}
+
+	for _, page := range doc.Pages {
+		expandTOCWidgets(page.Children, headings)
+	}
+}
+
+// expandTOCWidgets fills the <toc> widgets with their entries, the <toc>
+// keeps its box around them and is split between entries like a list
+func expandTOCWidgets(widgets []*Widget, headings []*Widget) {
+	for _, w := range widgets {
+		if w.TOC == nil {
+			expandTOCWidgets(w.Children, headings)
+			continue
+		}
+
+		w.Type = "div"
+		w.Direction = "column"
+		w.Children = []*Widget{}
+		for _, heading := range headings {
+			if heading.Heading <= w.TOC.Levels {
+				w.Children = append(w.Children, tocEntry(w, heading))
+			}
+		}
+	}
+}
+
+// tocEntry creates the row of a heading: its text followed by the leader
+// and the page number, set by setTOCPageNumbers.
+func tocEntry(toc *Widget, heading *Widget) *Widget {
+	text := &Widget{
+		Type:       "div",
+		Value:      widgetText(heading),
+		Leader:     toc.TOC.Leader,
+		FontFamily: toc.FontFamily,
+		FontSize:   toc.FontSize,
+		Bold:       toc.Bold,
+		Color:      toc.Color,
+		LineHeight: toc.LineHeight,
+	}
+	// wrapped to the width left by the number with the layout
+	text.ValueLines = []string{text.Value}
+
+	number := &Widget{
+		Type:       "div",
+		Rect:       Rect{Width: toc.TOC.NumberWidth},
+		Align:      "right",
+		Option:     &CellOption{Align: RIGHT},
+		VAlign:     VAlignBottom,
+		FontFamily: toc.FontFamily,
+		FontSize:   toc.FontSize,
+		Bold:       toc.Bold,
+		Color:      toc.Color,
+		LineHeight: toc.LineHeight,
+		TOCTarget:  heading,
+	}
+
+	return &Widget{
+		Type:       "div",
+		Direction:  "row",
+		AlignItems: AlignItemsStretch,
+		Margin:     &Box{Left: toc.TOC.Indent * float64(heading.Heading-1)},
+		Children:   []*Widget{text, number},
+	}
+}
+
+// hasTOC reports whether the pages have a table of contents with entries
+func hasTOC(pages []*Page) bool {
+	found := false
+	for _, page := range pages {
+		for _, w := range page.Children {
+			w.forEach(func(w *Widget) {
+				if w.TOCTarget != nil {
+					found = true
+				}
+			})
+		}
+	}
+	return found
+}
+
+// widenTOCNumbers widens the page number column of the tables of contents
+// whose numbers don't fit, measured on the laid out pages, and sets the
+// new width on the entries of source, the pages before the layout. It
+// reports whether a column was widened.
+func (l *Layouter) widenTOCNumbers(pages []*Page, source []*Page) bool {
+	widths := map[*TOC]float64{}
+	for _, page := range pages {
+		for _, w := range page.Children {
+			w.forEach(func(w *Widget) {
+				if w.TOC == nil {
+					return
+				}
+				for _, entry := range w.Children {
+					number := entry.Children[1]
+					width := l.measureTextWidth(number.Calculated.FontSize, strings.Join(number.ValueLines, ""))
+					widths[w.TOC] = math.Max(widths[w.TOC], width)
+				}
+			})
+		}
+	}
+
+	widened := false
+	for toc, width := range widths {
+		if width > toc.NumberWidth {
+			toc.NumberWidth = math.Ceil(width)
+			widened = true
+		}
+	}
+	if !widened {
+		return false
+	}
+
+	for _, page := range source {
+		for _, w := range page.Children {
+			w.forEach(func(w *Widget) {
+				if w.TOC == nil {
+					return
+				}
+				for _, entry := range w.Children {
+					entry.Children[1].Width = w.TOC.NumberWidth
+				}
+			})
+		}
+	}
+
+	return true
+}
+
+// setTOCPageNumbers writes the page number of their heading in the
+// entries of the tables of contents
+func (l *Layouter) setTOCPageNumbers(doc *Document, headingPages map[*Widget]string) {
+	for _, page := range doc.Pages {
+		for _, w := range page.Children {
+			w.forEach(func(w *Widget) {
+				if w.TOCTarget != nil {
+					w.ValueLines = []string{headingPages[w.TOCTarget]}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// renderedTransform is the matrix of a transformed widget, in the top left
+// coordinates of the page, and the index of the page it is drawn on
+type renderedTransform struct {
+	matrix svgMatrix
+	page   int
+}
+
+// addTransforms replaces the transform markers of the content of the
+// pages with their matrices, as an incremental update. The marker is an
+// empty "q Q" before the "q" that saves the state of the widget, which the
+// PDF library never writes by itself.
+func (r *Renderer) addTransforms(data []byte) ([]byte, error) {
+	file, err := readPDFFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := file.pages()
+	if err != nil {
+		return nil, err
+	}
+
+	matrices := map[int][]svgMatrix{}
+	for _, t := range r.transforms {
+		if t.page < 0 || t.page >= len(pages) {
+			return nil, fmt.Errorf("transform: page %d not found", t.page+1)
+		}
+		matrices[t.page] = append(matrices[t.page], t.matrix)
+	}
+
+	u := newPDFUpdate(file)
+	for i, page := range pages {
+		if len(matrices[i]) == 0 {
+			continue
+		}
+
+		var content []byte
+		refs := pdfArray(pdfDictValue(page.dict, "Contents"))
+		if len(refs) == 0 {
+			refs = []string{pdfDictValue(page.dict, "Contents")}
+		}
+		for _, ref := range refs {
+			num, ok := pdfRef(ref)
+			if !ok {
+				return nil, fmt.Errorf("transform: invalid contents of page %d", i+1)
+			}
+			data, err := file.stream(num)
+			if err != nil {
+				return nil, err
+			}
+			content = append(append(content, data...), '\n')
+		}
+
+		content, err = replaceTransformMarkers(content, matrices[i], page.height)
+		if err != nil {
+			return nil, fmt.Errorf("transform: page %d: %w", i+1, err)
+		}
+
+		var b bytes.Buffer
+		zw := zlib.NewWriter(&b)
+		zw.Write(content)
+		zw.Close()
+
+		num := u.addStream("/Filter /FlateDecode", b.Bytes())
+		u.set(page.num, pdfSetDictValue(page.dict, "Contents", fmt.Sprintf("%d 0 R", num)))
+	}
+
+	return u.bytes(), nil
+}
+
+// replaceTransformMarkers writes the matrices in place of the markers of
+// a content stream, in order. The matrices are converted to the bottom
+// left coordinates of the page.
+func replaceTransformMarkers(content []byte, matrices []svgMatrix, height float64) ([]byte, error) {
+	flip := svgMatrix{1, 0, 0, -1, 0, height}
+
+	var out bytes.Buffer
+	var ops []pdfToken
+	written, found := 0, 0
+	err := scanPDFContent(content, func(t pdfToken) {
+		ops = append(ops, t)
+		if len(ops) > 3 {
+			ops = ops[1:]
+		}
+		if len(ops) < 3 || string(content[ops[0].start:ops[0].end]) != "q" ||
+			string(content[ops[1].start:ops[1].end]) != "Q" || string(content[ops[2].start:ops[2].end]) != "q" {
+			return
+		}
+
+		if found < len(matrices) {
+			m := flip.multiply(matrices[found]).multiply(flip)
+			out.Write(content[written:ops[0].start])
+			out.WriteString("q")
+			for _, v := range m {
+				out.WriteString(" " + strconv.FormatFloat(math.Round(v*1e6)/1e6, 'f', -1, 64))
+			}
+			out.WriteString(" cm")
+			written = ops[2].end
+		}
+		found++
+		ops = nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if found != len(matrices) {
+		return nil, fmt.Errorf("found %d transform markers, expected %d", found, len(matrices))
+	}
+
+	out.Write(content[written:])
+	return out.Bytes(), nil
+}
+
+// pdfToken is the position of a token of a content stream
+type pdfToken struct {
+	start, end int
+}
+
+// scanPDFContent calls fn with the operators and operands of a content
+// stream, skipping comments, strings and inline images
+func scanPDFContent(content []byte, fn func(t pdfToken)) error {
+	i := 0
+	for i < len(content) {
+		c := content[i]
+		switch {
+		case isPDFSpace(c):
+			i++
+
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+
+		case c == '(':
+			depth := 0
+			for ; i < len(content); i++ {
+				if content[i] == '\\' {
+					i++
+				} else if content[i] == '(' {
+					depth++
+				} else if content[i] == ')' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if i >= len(content) {
+				return fmt.Errorf("unterminated string")
+			}
+			i++
+
+		case c == '<' && i+1 < len(content) && content[i+1] != '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end == -1 {
+				return fmt.Errorf("unterminated hex string")
+			}
+			i += end + 1
+
+		case c == '<' || c == '>':
+			i += 2
+
+		case c == '[' || c == ']' || c == '{' || c == '}':
+			i++
+
+		default:
+			start := i
+			for i++; i < len(content) && !isPDFDelimiter(content[i]); i++ {
+			}
+			fn(pdfToken{start, i})
+
+			// the data of an inline image ends with EI
+			if string(content[start:i]) == "ID" {
+				end := i
+				for {
+					next := bytes.Index(content[end:], []byte("EI"))
+					if next == -1 {
+						return fmt.Errorf("unterminated inline image")
+					}
+					end += next
+					if isPDFSpace(content[end-1]) && (end+2 == len(content) || isPDFDelimiter(content[end+2])) {
+						break
+					}
+					end += 2
+				}
+				i = end + 2
+			}
+		}
+	}
+
+	return nil
+}